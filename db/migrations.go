@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Migration is one versioned step of a SQL schema, versions must be unique and
+// increasing. Applied migrations are never edited, add a new one instead.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Migrate applies, in order and each one in its own transaction, every
+// migration not yet recorded in the schema_migrations table
+func Migrate(conn *sql.DB, migrations []Migration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+
+	var current int
+	err = conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%v) failed: %v", migration.Version, migration.Name, err)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+			migration.Version, migration.Name, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		log.Printf("Applied migration %d (%v)\n", migration.Version, migration.Name)
+		current = migration.Version
+	}
+	return nil
+}
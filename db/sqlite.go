@@ -0,0 +1,277 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	_ "modernc.org/sqlite"
+)
+
+var sqliteMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		SQL: `
+CREATE TABLE companies (
+	seq  INTEGER PRIMARY KEY AUTOINCREMENT,
+	id   TEXT NOT NULL UNIQUE,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE suppliers (
+	seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+	id         TEXT NOT NULL UNIQUE,
+	company_id TEXT NOT NULL REFERENCES companies (id) ON DELETE CASCADE,
+	name       TEXT NOT NULL DEFAULT '',
+	country    TEXT NOT NULL DEFAULT '',
+	city       TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX suppliers_company ON suppliers (company_id);
+
+CREATE TABLE materials (
+	seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+	id          TEXT NOT NULL UNIQUE,
+	company_id  TEXT NOT NULL REFERENCES companies (id) ON DELETE CASCADE,
+	name        TEXT NOT NULL DEFAULT '',
+	supplier_id TEXT REFERENCES suppliers (id),
+	origin      TEXT NOT NULL DEFAULT '',
+	sustainable INTEGER NOT NULL DEFAULT 0,
+	details     TEXT NOT NULL DEFAULT '',
+	last_order  TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX materials_company ON materials (company_id);
+CREATE INDEX materials_supplier ON materials (supplier_id);
+
+CREATE TABLE products (
+	seq                 INTEGER PRIMARY KEY AUTOINCREMENT,
+	id                  TEXT NOT NULL UNIQUE,
+	company_id          TEXT NOT NULL REFERENCES companies (id) ON DELETE CASCADE,
+	name                TEXT NOT NULL DEFAULT '',
+	made_in             TEXT NOT NULL DEFAULT '',
+	price               REAL NOT NULL DEFAULT 0,
+	description         TEXT NOT NULL DEFAULT '',
+	sustainable_package INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX products_company ON products (company_id);
+
+CREATE TABLE product_materials (
+	product_id  TEXT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+	material_id TEXT NOT NULL REFERENCES materials (id),
+	position    INTEGER NOT NULL,
+	PRIMARY KEY (product_id, position)
+);
+CREATE INDEX product_materials_material ON product_materials (material_id);
+
+CREATE TABLE certs (
+	seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+	id         TEXT NOT NULL UNIQUE,
+	company_id TEXT NOT NULL REFERENCES companies (id) ON DELETE CASCADE,
+	name       TEXT NOT NULL DEFAULT '',
+	issuer     TEXT NOT NULL DEFAULT '',
+	details    TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX certs_company ON certs (company_id);
+`,
+	},
+	{
+		Version: 2,
+		Name:    "certification subjects and validity",
+		SQL: `
+ALTER TABLE certs ADD COLUMN number TEXT NOT NULL DEFAULT '';
+ALTER TABLE certs ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+ALTER TABLE certs ADD COLUMN issue_date TEXT NOT NULL DEFAULT '';
+ALTER TABLE certs ADD COLUMN expiry_date TEXT NOT NULL DEFAULT '';
+ALTER TABLE certs ADD COLUMN subject_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE certs ADD COLUMN subject_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX certs_subject ON certs (subject_id);
+`,
+	},
+	{
+		Version: 3,
+		Name:    "api keys",
+		SQL: `
+CREATE TABLE api_keys (
+	seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+	id         TEXT NOT NULL UNIQUE,
+	company_id TEXT NOT NULL REFERENCES companies (id) ON DELETE CASCADE,
+	name       TEXT NOT NULL DEFAULT '',
+	prefix     TEXT NOT NULL DEFAULT '',
+	hash       TEXT NOT NULL UNIQUE,
+	created_at TEXT NOT NULL DEFAULT '',
+	revoked    INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX api_keys_company ON api_keys (company_id);
+`,
+	},
+	{
+		Version: 4,
+		Name:    "users and sessions",
+		SQL: `
+CREATE TABLE users (
+	seq           INTEGER PRIMARY KEY AUTOINCREMENT,
+	id            TEXT NOT NULL UNIQUE,
+	company_id    TEXT NOT NULL REFERENCES companies (id) ON DELETE CASCADE,
+	email         TEXT NOT NULL UNIQUE,
+	name          TEXT NOT NULL DEFAULT '',
+	password_hash TEXT NOT NULL,
+	created_at    TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX users_company ON users (company_id);
+
+CREATE TABLE sessions (
+	seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+	id         TEXT NOT NULL UNIQUE,
+	company_id TEXT NOT NULL REFERENCES companies (id) ON DELETE CASCADE,
+	user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	created_at TEXT NOT NULL DEFAULT '',
+	expires_at TEXT NOT NULL DEFAULT '',
+	revoked    INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX sessions_user ON sessions (user_id);
+`,
+	},
+	{
+		Version: 5,
+		Name:    "roles",
+		SQL: `
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'auditor';
+ALTER TABLE api_keys ADD COLUMN role TEXT NOT NULL DEFAULT 'admin';
+`,
+	},
+	{
+		Version: 6,
+		Name:    "audit log",
+		SQL: `
+CREATE TABLE audit (
+	seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+	company_id  TEXT NOT NULL,
+	actor       TEXT NOT NULL,
+	at          TEXT NOT NULL,
+	entity_type TEXT NOT NULL,
+	entity_id   TEXT NOT NULL,
+	operation   TEXT NOT NULL,
+	before_json TEXT NOT NULL DEFAULT '',
+	after_json  TEXT NOT NULL DEFAULT '',
+	diff_json   TEXT NOT NULL DEFAULT '{}'
+);
+CREATE INDEX audit_entity ON audit (company_id, entity_id);
+`,
+	},
+	{
+		Version: 7,
+		Name:    "record versions",
+		SQL: `
+ALTER TABLE products ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE materials ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE suppliers ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE certs ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		Version: 8,
+		Name:    "trash",
+		SQL: `
+CREATE TABLE trash (
+	seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+	company_id  TEXT NOT NULL,
+	entity_type TEXT NOT NULL,
+	entity_id   TEXT NOT NULL,
+	deleted_at  TEXT NOT NULL,
+	deleted_by  TEXT NOT NULL,
+	record_json TEXT NOT NULL,
+	UNIQUE (company_id, entity_id)
+);
+CREATE INDEX trash_deleted_at ON trash (deleted_at);
+`,
+	},
+	{
+		Version: 9,
+		Name:    "lots",
+		SQL: `
+CREATE TABLE lots (
+	seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+	id          TEXT NOT NULL UNIQUE,
+	company_id  TEXT NOT NULL REFERENCES companies (id) ON DELETE CASCADE,
+	material_id TEXT NOT NULL DEFAULT '',
+	supplier_id TEXT NOT NULL DEFAULT '',
+	quantity    REAL NOT NULL DEFAULT 0,
+	unit        TEXT NOT NULL DEFAULT '',
+	received_at TEXT NOT NULL DEFAULT '',
+	assay       TEXT NOT NULL DEFAULT '',
+	version     INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX lots_material ON lots (material_id);
+CREATE TABLE product_lots (
+	product_id TEXT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+	lot_id     TEXT NOT NULL REFERENCES lots (id),
+	position   INTEGER NOT NULL,
+	PRIMARY KEY (product_id, position)
+);
+CREATE INDEX product_lots_lot ON product_lots (lot_id);
+`,
+	},
+	{
+		Version: 10,
+		Name:    "material provenance",
+		SQL: `
+ALTER TABLE materials ADD COLUMN provenance_json TEXT NOT NULL DEFAULT '[]';
+`,
+	},
+	{
+		Version: 11,
+		Name:    "bill of materials",
+		SQL: `
+CREATE TABLE product_bom (
+	product_id  TEXT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+	material_id TEXT NOT NULL REFERENCES materials (id),
+	position    INTEGER NOT NULL,
+	quantity    REAL NOT NULL,
+	unit        TEXT NOT NULL,
+	waste_pct   REAL NOT NULL DEFAULT 0,
+	PRIMARY KEY (product_id, position)
+);
+`,
+	},
+	{
+		Version: 12,
+		Name:    "costs",
+		SQL: `
+ALTER TABLE materials ADD COLUMN costs_json TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE products ADD COLUMN costs_json TEXT NOT NULL DEFAULT '[]';
+`,
+	},
+}
+
+// ConnectSQLite opens (or creates) the database file at path and brings its
+// schema up to date
+func ConnectSQLite(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%v?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+
+	if err := Migrate(conn, sqliteMigrations); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	fmt.Println("DB ok!")
+	return conn, nil
+}
+
+func DisconnectSQL(conn *sql.DB) {
+	if conn == nil {
+		return
+	}
+
+	err := conn.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("SQL database closed")
+}
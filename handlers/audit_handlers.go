@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"marvinhagler/models"
+	"net/http"
+)
+
+type AuditEnv struct {
+	Audit models.AuditRepository
+}
+
+func (env *AuditEnv) GetAuditHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /audit?entity=my_id
+		id := r.URL.Query().Get("entity")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		entries, err := env.Audit.GetByEntity(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(entries)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,43 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"marvinhagler/models"
+	"net/http"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+
+	w := s.do(http.MethodPut, c.prefix+"/products/update", map[string]interface{}{
+		"id": c.product, "name": "Gold ring", "price": 120, "materials": []map[string]string{{"id": c.material}},
+	}, ifMatch(1)...)
+	expectStatus(t, w, http.StatusOK)
+	w = s.do(http.MethodDelete, c.prefix+"/products/delete-product?id="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+
+	w = s.do(http.MethodGet, c.prefix+"/audit?entity="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+	var entries []models.AuditEntry
+	decode(t, w, &entries)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want add, update and delete: %+v", len(entries), entries)
+	}
+	for i, operation := range []string{models.OperationAdd, models.OperationUpdate, models.OperationDelete} {
+		if entries[i].Operation != operation || entries[i].EntityType != models.EntityProduct || entries[i].Actor == "" {
+			t.Errorf("entry %d: got %v of %v by %q, want %v of a product", i, entries[i].Operation, entries[i].EntityType, entries[i].Actor, operation)
+		}
+	}
+	if _, ok := entries[1].Diff["name"]; !ok || len(entries[1].Before) == 0 || len(entries[1].After) == 0 {
+		t.Errorf("got update %+v, want both records and the name in the diff", entries[1])
+	}
+	var updated models.Product
+	if err := json.Unmarshal(entries[1].After, &updated); err != nil || updated.Version != 2 {
+		t.Errorf("got update after %s, want version 2: %v", entries[1].After, err)
+	}
+	if len(entries[2].After) != 0 {
+		t.Errorf("delete has a record after: %s", entries[2].After)
+	}
+}
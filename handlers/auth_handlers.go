@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"marvinhagler/helpers"
+	"marvinhagler/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type AuthEnv struct {
+	Users       models.UserRepository
+	Sessions    models.SessionRepository
+	TokenSecret []byte
+	TokenTTL    time.Duration
+}
+
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type loginResult struct {
+	Token     string      `json:"token"`
+	ExpiresAt string      `json:"expiresAt"`
+	User      models.User `json:"user"`
+}
+
+type passwordChange struct {
+	OldPassword string `json:"oldPassword"`
+	NewPassword string `json:"newPassword"`
+}
+
+// whoami describes the principal of a request
+type whoami struct {
+	CompanyID string       `json:"companyId,omitempty"`
+	User      *models.User `json:"user,omitempty"`
+	KeyID     string       `json:"keyId,omitempty"`
+	Role      models.Role  `json:"role,omitempty"`
+	Admin     bool         `json:"admin"`
+}
+
+// missingUserHash is compared against when the email is unknown, so failed
+// logins take as long whether or not the user exists
+var missingUserHash, _ = bcrypt.GenerateFromPassword([]byte("missing user"), bcrypt.DefaultCost)
+
+func (env *AuthEnv) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var login credentials
+
+		err := json.NewDecoder(r.Body).Decode(&login)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("JSON Error: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		user, err := env.Users.FindByEmail(r.Context(), strings.ToLower(strings.TrimSpace(login.Email)))
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		hash := missingUserHash
+		if user != nil {
+			hash = []byte(user.PasswordHash)
+		}
+		if bcrypt.CompareHashAndPassword(hash, []byte(login.Password)) != nil || user == nil {
+			http.Error(w, "Wrong email or password", http.StatusUnauthorized)
+			return
+		}
+
+		now := time.Now().UTC()
+		session := models.Session{
+			Id:        helpers.GenerateId("SES-"),
+			UserID:    user.Id,
+			CreatedAt: now.Format(time.RFC3339),
+			ExpiresAt: now.Add(env.TokenTTL).Format(time.RFC3339),
+		}
+		ctx := models.WithCompany(r.Context(), user.CompanyID)
+		err = env.Sessions.Add(ctx, session)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		token, err := helpers.SignToken(env.TokenSecret, helpers.TokenClaims{
+			SessionID: session.Id,
+			UserID:    user.Id,
+			CompanyID: user.CompanyID,
+			ExpiresAt: now.Add(env.TokenTTL).Unix(),
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(loginResult{Token: token, ExpiresAt: session.ExpiresAt, User: *user})
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *AuthEnv) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		principal, _ := models.PrincipalFrom(r.Context())
+		if principal.SessionID == "" {
+			http.Error(w, "Only session tokens can log out", http.StatusBadRequest)
+			return
+		}
+
+		err := env.Sessions.Revoke(r.Context(), principal.SessionID)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode("Logged out")
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ChangePasswordHandler changes the password of the logged in user and logs
+// out every other session of theirs
+func (env *AuthEnv) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		principal, _ := models.PrincipalFrom(r.Context())
+		if principal.UserID == "" {
+			http.Error(w, "Only logged in users can change their password", http.StatusBadRequest)
+			return
+		}
+
+		var change passwordChange
+		err := json.NewDecoder(r.Body).Decode(&change)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("JSON Error: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		user, err := env.Users.GetOne(r.Context(), principal.UserID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(change.OldPassword)) != nil {
+			http.Error(w, "Wrong password", http.StatusUnauthorized)
+			return
+		}
+		user.PasswordHash, err = hashPassword(change.NewPassword)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		err = env.Users.Update(r.Context(), *user)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		err = env.Sessions.RevokeByUser(r.Context(), user.Id, principal.SessionID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode("Password changed")
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *AuthEnv) MeHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		principal, _ := models.PrincipalFrom(r.Context())
+		me := whoami{CompanyID: principal.CompanyID, KeyID: principal.KeyID, Role: principal.Role, Admin: principal.Admin}
+		if principal.UserID != "" {
+			user, err := env.Users.GetOne(r.Context(), principal.UserID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				return
+			}
+			me.User = user
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err := json.NewEncoder(w).Encode(me)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"marvinhagler/models"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// The bill of materials of a product says how much of each material one unit
+// of it takes. Its materials are part of the materials of the product, the
+// ones missing there are added so references keep being checked in one place.
+
+// checkBOM checks the quantities, units and waste percentages of the bill of
+// materials of product
+func checkBOM(product models.Product) error {
+	for i, line := range product.BOM {
+		if line.MaterialID == "" {
+			return fmt.Errorf("bom line %d has no materialId", i+1)
+		}
+		if line.Quantity <= 0 {
+			return fmt.Errorf("bom line %d: quantity must be greater than 0", i+1)
+		}
+		if !line.Unit.Valid() {
+			return fmt.Errorf("bom line %d: unknown unit %q, use one of %v", i+1, line.Unit, models.Units)
+		}
+		if line.WastePct < 0 || line.WastePct >= 100 {
+			return fmt.Errorf("bom line %d: wastePct must be from 0 to less than 100", i+1)
+		}
+	}
+	return nil
+}
+
+// bomMaterials adds the materials of the bill of materials of product that
+// are not among its materials yet, canonicalMaterials resolves them after
+func bomMaterials(product *models.Product) {
+	listed := map[string]bool{}
+	for _, material := range product.Materials {
+		listed[material.Id] = true
+	}
+	for _, line := range product.BOM {
+		if !listed[line.MaterialID] {
+			listed[line.MaterialID] = true
+			product.Materials = append(product.Materials, models.Material{Id: line.MaterialID})
+		}
+	}
+}
+
+// mergeBOMLines adds up two lines of the same material and unit, the waste
+// percentage is weighted so the gross quantity stays the same
+func mergeBOMLines(line, other models.BOMLine) models.BOMLine {
+	quantity := line.Quantity + other.Quantity
+	line.WastePct = (line.Quantity*line.WastePct + other.Quantity*other.WastePct) / quantity
+	line.Quantity = quantity
+	return line
+}
+
+// requirement is how much of a material, in one unit of measure, a number of
+// units of a product takes
+type requirement struct {
+	MaterialID string      `json:"materialId"`
+	Name       string      `json:"name"`
+	Unit       models.Unit `json:"unit"`
+	Net        float64     `json:"net"`
+	Waste      float64     `json:"waste"`
+	Total      float64     `json:"total"`
+}
+
+type requirements struct {
+	ProductID string        `json:"productId"`
+	Name      string        `json:"name"`
+	Units     int           `json:"units"`
+	Materials []requirement `json:"materials"`
+}
+
+// roundQuantity keeps 4 decimals, enough for carats and grams
+func roundQuantity(quantity float64) float64 {
+	return math.Round(quantity*10000) / 10000
+}
+
+// productRequirements sums the bill of materials of product for units, lines
+// of the same material and unit are added up
+func productRequirements(product models.Product, units int) requirements {
+	names := map[string]string{}
+	for _, material := range product.Materials {
+		names[material.Id] = material.Name
+	}
+
+	result := requirements{ProductID: product.Id, Name: product.Name, Units: units, Materials: []requirement{}}
+	index := map[string]int{}
+	for _, line := range product.BOM {
+		key := line.MaterialID + "/" + string(line.Unit)
+		i, ok := index[key]
+		if !ok {
+			i = len(result.Materials)
+			index[key] = i
+			result.Materials = append(result.Materials, requirement{MaterialID: line.MaterialID, Name: names[line.MaterialID], Unit: line.Unit})
+		}
+		net := line.Quantity * float64(units)
+		result.Materials[i].Net += net
+		result.Materials[i].Total += line.Gross(float64(units))
+		result.Materials[i].Waste = result.Materials[i].Total - result.Materials[i].Net
+	}
+	for i := range result.Materials {
+		result.Materials[i].Net = roundQuantity(result.Materials[i].Net)
+		result.Materials[i].Waste = roundQuantity(result.Materials[i].Waste)
+		result.Materials[i].Total = roundQuantity(result.Materials[i].Total)
+	}
+	return result
+}
+
+func (env *ProductsEnv) GetRequirementsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /products/requirements?id=my_id&units=100
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+		units, err := strconv.Atoi(r.URL.Query().Get("units"))
+		if err != nil || units <= 0 {
+			http.Error(w, "units must be a whole number greater than 0", http.StatusBadRequest)
+			return
+		}
+
+		product, err := env.Products.GetOne(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+		if len(product.BOM) == 0 {
+			http.Error(w, "Product has no bill of materials", http.StatusUnprocessableEntity)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(productRequirements(*product, units))
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
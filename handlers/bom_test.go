@@ -0,0 +1,59 @@
+package handlers_test
+
+import (
+	"marvinhagler/models"
+	"net/http"
+	"testing"
+)
+
+func TestRequirements(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	// 3.2 g of gold a ring, 8% of which goes to waste
+	product := s.add(c.prefix+"/products/add", map[string]interface{}{
+		"name": "Gold ring", "bom": []map[string]interface{}{{"materialId": c.material, "quantity": 3.2, "unit": "g", "wastePct": 8}},
+	})
+
+	var result struct {
+		Units     int `json:"units"`
+		Materials []struct {
+			MaterialID string      `json:"materialId"`
+			Unit       models.Unit `json:"unit"`
+			Net        float64     `json:"net"`
+			Waste      float64     `json:"waste"`
+			Total      float64     `json:"total"`
+		} `json:"materials"`
+	}
+	w := s.do(http.MethodGet, c.prefix+"/products/requirements?id="+product+"&units=100", nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &result)
+	if len(result.Materials) != 1 {
+		t.Fatalf("got %+v, want one material", result.Materials)
+	}
+	got := result.Materials[0]
+	if got.MaterialID != c.material || got.Unit != models.UnitGram || got.Net != 320 || got.Waste != 25.6 || got.Total != 345.6 {
+		t.Errorf("got %+v, want 320 g of %v and 25.6 g of waste", got, c.material)
+	}
+
+	w = s.do(http.MethodGet, c.prefix+"/products/requirements?id="+product+"&units=0", nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestAddProductWrongBOM(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+
+	for _, line := range []map[string]interface{}{
+		{"materialId": c.material, "quantity": 3, "unit": "oz"},
+		{"materialId": c.material, "quantity": 0, "unit": "g"},
+		{"materialId": c.material, "quantity": 3, "unit": "g", "wastePct": 100},
+	} {
+		w := s.do(http.MethodPost, c.prefix+"/products/add", map[string]interface{}{"name": "Ring", "bom": []interface{}{line}})
+		expectStatus(t, w, http.StatusBadRequest)
+	}
+
+	w := s.do(http.MethodPost, c.prefix+"/products/add", map[string]interface{}{
+		"name": "Ring", "bom": []map[string]interface{}{{"materialId": missingID, "quantity": 3, "unit": "g"}},
+	})
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+}
@@ -6,11 +6,39 @@ import (
 	"log"
 	"marvinhagler/helpers"
 	"marvinhagler/models"
+	"marvinhagler/monitor"
 	"net/http"
+	"time"
 )
 
 type CertsEnv struct {
-	Certs *models.CertModel
+	Certs     models.CertRepository
+	Suppliers models.SupplierRepository
+	Materials models.MaterialRepository
+	Products  models.ProductRepository
+	Lots      models.LotRepository
+	Audit     models.AuditRepository
+}
+
+// checkCertDates checks IssueDate and ExpiryDate are empty or dates like
+// 2024-12-31, and that the certification does not expire before being issued
+func checkCertDates(cert models.Cert) error {
+	var issued, expires time.Time
+	var err error
+	if cert.IssueDate != "" {
+		if issued, err = time.Parse(models.CertDateLayout, cert.IssueDate); err != nil {
+			return fmt.Errorf("wrong issueDate %q, use YYYY-MM-DD", cert.IssueDate)
+		}
+	}
+	if cert.ExpiryDate != "" {
+		if expires, err = time.Parse(models.CertDateLayout, cert.ExpiryDate); err != nil {
+			return fmt.Errorf("wrong expiryDate %q, use YYYY-MM-DD", cert.ExpiryDate)
+		}
+	}
+	if !issued.IsZero() && !expires.IsZero() && expires.Before(issued) {
+		return fmt.Errorf("expiryDate %v is before issueDate %v", cert.ExpiryDate, cert.IssueDate)
+	}
+	return nil
 }
 
 func (env *CertsEnv) AddCertHandler(w http.ResponseWriter, r *http.Request) {
@@ -25,8 +53,25 @@ func (env *CertsEnv) AddCertHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		certData.Id = helpers.GenerateId("CERT-")
+		certData.Version = 1
+
+		err = checkCertDates(certData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
 
-		err = env.Certs.Add(certData)
+		exists, err := certSubjectExists(r.Context(), env.Suppliers, env.Materials, env.Products, env.Lots, certData.Subject)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		if !exists {
+			writeUnknownReferences(w, unknownSubject(certData.Subject))
+			return
+		}
+
+		err = env.Certs.Add(r.Context(), certData)
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusInternalServerError)
@@ -34,6 +79,7 @@ func (env *CertsEnv) AddCertHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		w.Header().Set("Content-Type", "application/json")
+		setETag(w, certData.Version)
 		w.WriteHeader(http.StatusCreated)
 
 		err = json.NewEncoder(w).Encode(certData)
@@ -48,10 +94,66 @@ func (env *CertsEnv) AddCertHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func (env *CertsEnv) UpdateCertHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		var certData models.Cert
+
+		err := json.NewDecoder(r.Body).Decode(&certData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("JSON Error: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		version, ok := ifMatch(w, r)
+		if !ok {
+			return
+		}
+		certData.Version = version
+
+		err = checkCertDates(certData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		exists, err := certSubjectExists(r.Context(), env.Suppliers, env.Materials, env.Products, env.Lots, certData.Subject)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		if !exists {
+			writeUnknownReferences(w, unknownSubject(certData.Subject))
+			return
+		}
+
+		err = env.Certs.Update(r.Context(), certData)
+		if err != nil {
+			updateError(w, err)
+			return
+		}
+		certData.Version++
+
+		w.Header().Set("Content-Type", "application/json")
+		setETag(w, certData.Version)
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(certData)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+
+}
+
 func (env *CertsEnv) GetAllCertsHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		certs, err := env.Certs.GetAll()
+		certs, err := env.Certs.GetAll(r.Context())
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusBadRequest)
@@ -71,3 +173,147 @@ func (env *CertsEnv) GetAllCertsHandler(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
+
+func (env *CertsEnv) GetOneCertHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /find-cert?id=my_id[&at=2026-01-01T00:00:00Z]
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		at, err := parseAt(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		var cert *models.Cert
+		if at.IsZero() {
+			cert, err = env.Certs.GetOne(r.Context(), id)
+		} else {
+			cert = &models.Cert{}
+			err = models.RecordAt(r.Context(), env.Audit, models.EntityCert, id, at, cert)
+		}
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if at.IsZero() {
+			setETag(w, cert.Version)
+		}
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(cert)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *CertsEnv) DeleteOneCertHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		// /delete-cert?id=my_id
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		err := env.Certs.DeleteOne(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode("Certification deleted")
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *CertsEnv) GetCertsBySubjectHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /find-by-subject?subject_id=id
+		id := r.URL.Query().Get("subject_id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		certs, err := env.Certs.GetBySubject(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(certs)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *CertsEnv) GetExpiringCertsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /expiring?within=30d
+		within := r.URL.Query().Get("within")
+		if within == "" {
+			within = "30d"
+		}
+		duration, err := monitor.ParseWithin(within)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		report, err := monitor.CertExpiry(r.Context(), env.Certs, env.Suppliers, env.Materials, time.Now(), duration)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(report)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
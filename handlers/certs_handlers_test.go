@@ -0,0 +1,99 @@
+package handlers_test
+
+import (
+	"marvinhagler/models"
+	"net/http"
+	"testing"
+)
+
+// cert adds a certification about the record of subjectType with subjectID
+func (s *testServer) cert(prefix, subjectType, subjectID string) string {
+	s.t.Helper()
+	return s.add(prefix+"/certs/add", map[string]interface{}{
+		"name": "RJC", "subject": map[string]string{"type": subjectType, "id": subjectID},
+	})
+}
+
+func TestDeleteCertifiedSupplier(t *testing.T) {
+	s := newTestServer(t)
+	prefix := s.company("acme")
+	supplier := s.add(prefix+"/suppliers/add", map[string]string{"name": "Silver Co", "country": "IT"})
+	cert := s.cert(prefix, models.SubjectSupplier, supplier)
+
+	w := s.do(http.MethodDelete, prefix+"/suppliers/delete-supplier?id="+supplier, nil)
+	expectStatus(t, w, http.StatusConflict)
+	var body conflict
+	decode(t, w, &body)
+	if len(body.Certs) != 1 || body.Certs[0] != cert {
+		t.Errorf("got certs %v, want [%v]", body.Certs, cert)
+	}
+
+	w = s.do(http.MethodDelete, prefix+"/suppliers/delete-supplier?id="+supplier+"&cascade=true", nil)
+	expectStatus(t, w, http.StatusOK)
+	var result deleteResult
+	decode(t, w, &result)
+	if len(result.DeletedCerts) != 1 || result.DeletedCerts[0] != cert {
+		t.Errorf("got %+v, want cert %v deleted", result, cert)
+	}
+	w = s.do(http.MethodGet, prefix+"/certs/find-cert?id="+cert, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = s.do(http.MethodPost, prefix+"/trash/restore?id="+cert, nil)
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+	for _, id := range []string{supplier, cert} {
+		w = s.do(http.MethodPost, prefix+"/trash/restore?id="+id, nil)
+		expectStatus(t, w, http.StatusOK)
+	}
+}
+
+func TestDeleteMaterialCascadeCerts(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	lot := s.lot(c.prefix, c.material)
+	productCert := s.cert(c.prefix, models.SubjectProduct, c.product)
+	lotCert := s.cert(c.prefix, models.SubjectLot, lot)
+
+	w := s.do(http.MethodDelete, c.prefix+"/materials/delete-material?id="+c.material+"&cascade=true", nil)
+	expectStatus(t, w, http.StatusOK)
+	var result deleteResult
+	decode(t, w, &result)
+	if len(result.DeletedCerts) != 2 {
+		t.Errorf("got %+v, want certs %v and %v deleted", result, productCert, lotCert)
+	}
+	for _, cert := range []string{productCert, lotCert} {
+		w = s.do(http.MethodGet, c.prefix+"/certs/find-cert?id="+cert, nil)
+		expectStatus(t, w, http.StatusBadRequest)
+	}
+}
+
+func TestLotCert(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	lot := s.lot(c.prefix, c.material)
+
+	w := s.do(http.MethodPost, c.prefix+"/certs/add", map[string]interface{}{
+		"name": "Assay", "subject": map[string]string{"type": models.SubjectLot, "id": missingID},
+	})
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+	var unknown struct {
+		Lots []string `json:"lots"`
+	}
+	decode(t, w, &unknown)
+	if len(unknown.Lots) != 1 || unknown.Lots[0] != missingID {
+		t.Errorf("got unknown lots %v, want [%v]", unknown.Lots, missingID)
+	}
+
+	cert := s.cert(c.prefix, models.SubjectLot, lot)
+	w = s.do(http.MethodDelete, c.prefix+"/lots/delete-lot?id="+lot, nil)
+	expectStatus(t, w, http.StatusConflict)
+	var body conflict
+	decode(t, w, &body)
+	if len(body.Certs) != 1 || body.Certs[0] != cert {
+		t.Errorf("got certs %v, want [%v]", body.Certs, cert)
+	}
+
+	w = s.do(http.MethodDelete, c.prefix+"/lots/delete-lot?id="+lot+"&cascade=true", nil)
+	expectStatus(t, w, http.StatusOK)
+	w = s.do(http.MethodGet, c.prefix+"/certs/find-cert?id="+cert, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
@@ -2,38 +2,57 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 	"log"
 	"marvinhagler/models"
 	"net/http"
-	"os"
+	"strings"
 )
 
 type CompanyEnv struct {
-	Company *models.CompanyModel
+	Company models.CompanyRepository
+}
+
+// companyName title-cases the name sent by the client, the way company names
+// have always been stored
+func companyName(name string) string {
+	caser := cases.Title(language.English)
+	return caser.String(strings.TrimSpace(name))
 }
 
 func (env *CompanyEnv) InitializeCompanyHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
+		var companyData models.Company
+
+		err := json.NewDecoder(r.Body).Decode(&companyData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("JSON Error: %v", err), http.StatusBadRequest)
+			return
+		}
 
-		companyFromEnv := os.Getenv("COMPANY")
-		caser := cases.Title(language.English)
-		companyNameCaser := caser.String(companyFromEnv)
+		companyData.Name = companyName(companyData.Name)
+		if companyData.Name == "" {
+			http.Error(w, "Company name is required", http.StatusBadRequest)
+			return
+		}
 
 		newCompany := models.Company{
-			Name:      companyNameCaser,
-			Products:  []models.Product{},
-			Materials: []models.Material{},
-			Suppliers: []models.Supplier{},
-			Certs:     []models.Cert{},
+			ID:   primitive.NewObjectID(),
+			Name: companyData.Name,
 		}
 
-		err := env.Company.Initialize(newCompany)
+		err = env.Company.Initialize(r.Context(), newCompany)
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
+			if errors.Is(err, models.ErrDuplicate) {
+				http.Error(w, thisErr, http.StatusConflict)
+				return
+			}
 			http.Error(w, thisErr, http.StatusInternalServerError)
 			return
 		}
@@ -41,7 +60,63 @@ func (env *CompanyEnv) InitializeCompanyHandler(w http.ResponseWriter, r *http.R
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 
-		err = json.NewEncoder(w).Encode(newCompany.Name)
+		err = json.NewEncoder(w).Encode(newCompany)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+
+}
+
+func (env *CompanyEnv) GetAllCompaniesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		companies, err := env.Company.GetAll(r.Context())
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(companies)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *CompanyEnv) GetOneCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /find-company?id=my_id
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		company, err := env.Company.GetOne(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(company)
 		if err != nil {
 			log.Println("Failed to encode response:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -50,5 +125,77 @@ func (env *CompanyEnv) InitializeCompanyHandler(w http.ResponseWriter, r *http.R
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
+}
+
+func (env *CompanyEnv) RenameCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		var companyData models.Company
+
+		err := json.NewDecoder(r.Body).Decode(&companyData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("JSON Error: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		companyData.Name = companyName(companyData.Name)
+		if companyData.ID.IsZero() || companyData.Name == "" {
+			http.Error(w, "Company _id and name are required", http.StatusBadRequest)
+			return
+		}
+
+		err = env.Company.Rename(r.Context(), companyData.ID.Hex(), companyData.Name)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			if errors.Is(err, models.ErrDuplicate) {
+				http.Error(w, thisErr, http.StatusConflict)
+				return
+			}
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
 
+		err = json.NewEncoder(w).Encode(models.Company{ID: companyData.ID, Name: companyData.Name})
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *CompanyEnv) DeleteOneCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		// /delete-company?id=my_id
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		err := env.Company.DeleteOne(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode("Company deleted")
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
 }
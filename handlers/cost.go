@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"marvinhagler/models"
+	"math"
+	"net/http"
+	"time"
+)
+
+// What a product costs to make is rolled up from its bill of materials,
+// priced with the costs of its materials in effect on the day, plus its labor
+// and overhead lines. The list price is only compared against it.
+
+// checkUnitCosts checks the price history of material: costs that are not
+// negative, known units and dates like 2024-12-31, one cost per unit and day
+func checkUnitCosts(material models.Material) error {
+	seen := map[string]bool{}
+	for i, cost := range material.Costs {
+		if cost.Cost < 0 {
+			return fmt.Errorf("cost %d must not be negative", i+1)
+		}
+		if !cost.Unit.Valid() {
+			return fmt.Errorf("unknown unit %q in cost %d, use one of %v", cost.Unit, i+1, models.Units)
+		}
+		if _, err := time.Parse(models.CertDateLayout, cost.EffectiveFrom); err != nil {
+			return fmt.Errorf("wrong effectiveFrom %q in cost %d, use YYYY-MM-DD", cost.EffectiveFrom, i+1)
+		}
+		key := string(cost.Unit) + "/" + cost.EffectiveFrom
+		if seen[key] {
+			return fmt.Errorf("cost %d repeats the cost per %v from %v", i+1, cost.Unit, cost.EffectiveFrom)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// checkCostLines checks the labor and overhead lines of product
+func checkCostLines(product models.Product) error {
+	for i, line := range product.Costs {
+		if line.Kind != models.CostLabor && line.Kind != models.CostOverhead {
+			return fmt.Errorf("unknown kind %q in cost line %d, use one of %v", line.Kind, i+1, models.CostKinds)
+		}
+		if line.Amount < 0 {
+			return fmt.Errorf("cost line %d: amount must not be negative", i+1)
+		}
+	}
+	return nil
+}
+
+// materialCost is what the quantity of a material in one unit of measure
+// that one unit of a product takes costs, waste included
+type materialCost struct {
+	MaterialID    string      `json:"materialId"`
+	Name          string      `json:"name"`
+	Unit          models.Unit `json:"unit"`
+	Quantity      float64     `json:"quantity"`
+	UnitCost      float64     `json:"unitCost"`
+	EffectiveFrom string      `json:"effectiveFrom"`
+	Cost          float64     `json:"cost"`
+}
+
+type productCost struct {
+	ProductID    string            `json:"productId"`
+	Name         string            `json:"name"`
+	Date         string            `json:"date"`
+	Materials    []materialCost    `json:"materials"`
+	Costs        []models.CostLine `json:"costs"`
+	MaterialCost float64           `json:"materialCost"`
+	Labor        float64           `json:"labor"`
+	Overhead     float64           `json:"overhead"`
+	UnitCost     float64           `json:"unitCost"`
+	Price        float64           `json:"price"`
+	Margin       float64           `json:"margin"`
+	MarginPct    *float64          `json:"marginPct,omitempty"`
+}
+
+// roundAmount keeps cents
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// productCost prices one unit of product on day with the stored materials,
+// product.Materials may be copies from when the product was saved. It returns
+// the IDs of the materials with no cost in effect for the unit of a line.
+func (env *ProductsEnv) productCost(ctx context.Context, product models.Product, day string) (productCost, []string, error) {
+	result := productCost{ProductID: product.Id, Name: product.Name, Date: day, Materials: []materialCost{}, Costs: []models.CostLine{}, Price: product.Price}
+
+	materials := map[string]*models.Material{}
+	index := map[string]int{}
+	var missing []string
+	seen := map[string]bool{}
+	for _, line := range product.BOM {
+		material, ok := materials[line.MaterialID]
+		if !ok {
+			var err error
+			material, err = env.Materials.GetOne(ctx, line.MaterialID)
+			if err != nil {
+				return result, nil, err
+			}
+			materials[line.MaterialID] = material
+		}
+
+		cost, ok := models.CostOn(material.Costs, line.Unit, day)
+		if !ok {
+			if !seen[line.MaterialID] {
+				seen[line.MaterialID] = true
+				missing = append(missing, line.MaterialID)
+			}
+			continue
+		}
+
+		key := line.MaterialID + "/" + string(line.Unit)
+		i, ok := index[key]
+		if !ok {
+			i = len(result.Materials)
+			index[key] = i
+			result.Materials = append(result.Materials, materialCost{MaterialID: material.Id, Name: material.Name, Unit: line.Unit,
+				UnitCost: cost.Cost, EffectiveFrom: cost.EffectiveFrom})
+		}
+		result.Materials[i].Quantity += line.Gross(1)
+	}
+	if len(missing) > 0 {
+		return result, missing, nil
+	}
+
+	for i, material := range result.Materials {
+		cost := material.Quantity * material.UnitCost
+		result.MaterialCost += cost
+		result.Materials[i].Quantity = roundQuantity(material.Quantity)
+		result.Materials[i].Cost = roundAmount(cost)
+	}
+	for _, line := range product.Costs {
+		result.Costs = append(result.Costs, line)
+		if line.Kind == models.CostLabor {
+			result.Labor += line.Amount
+		} else {
+			result.Overhead += line.Amount
+		}
+	}
+
+	unitCost := result.MaterialCost + result.Labor + result.Overhead
+	result.MaterialCost = roundAmount(result.MaterialCost)
+	result.Labor = roundAmount(result.Labor)
+	result.Overhead = roundAmount(result.Overhead)
+	result.UnitCost = roundAmount(unitCost)
+	result.Margin = roundAmount(product.Price - unitCost)
+	if product.Price > 0 {
+		pct := math.Round((product.Price-unitCost)/product.Price*10000) / 100
+		result.MarginPct = &pct
+	}
+	return result, nil, nil
+}
+
+func (env *ProductsEnv) GetCostHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /products/cost?id=my_id&date=2024-12-31
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+		day := r.URL.Query().Get("date")
+		if day == "" {
+			day = time.Now().UTC().Format(models.CertDateLayout)
+		} else if _, err := time.Parse(models.CertDateLayout, day); err != nil {
+			http.Error(w, "Wrong date format, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+
+		product, err := env.Products.GetOne(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+		if len(product.BOM) == 0 {
+			http.Error(w, "Product has no bill of materials", http.StatusUnprocessableEntity)
+			return
+		}
+
+		result, missing, err := env.productCost(r.Context(), *product, day)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(missing) > 0 {
+			writeUnknownReferences(w, unknownReferences{Error: "materials without a cost on " + day + " in the unit of their bill of materials line", Materials: missing})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(result)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers_test
+
+import (
+	"marvinhagler/models"
+	"net/http"
+	"testing"
+)
+
+// pricedRing is a ring taking 3.2 g of gold, 8% of which goes to waste, that
+// costs 50 a gram from 2026 and 60 from June
+func (s *testServer) pricedRing() (prefix, material, product string) {
+	s.t.Helper()
+	c := s.catalog(s.company("acme"))
+	material = s.add(c.prefix+"/materials/add", map[string]interface{}{
+		"name": "Fine gold", "supplier": map[string]string{"id": c.supplier},
+		"costs": []map[string]interface{}{
+			{"cost": 50, "unit": "g", "effectiveFrom": "2026-01-01"},
+			{"cost": 60, "unit": "g", "effectiveFrom": "2026-06-01"},
+		},
+	})
+	product = s.add(c.prefix+"/products/add", map[string]interface{}{
+		"name": "Gold ring", "price": 300,
+		"bom": []map[string]interface{}{{"materialId": material, "quantity": 3.2, "unit": "g", "wastePct": 8}},
+		"costs": []map[string]interface{}{
+			{"kind": models.CostLabor, "name": "Setting", "amount": 40},
+			{"kind": models.CostOverhead, "name": "Polishing", "amount": 10.5},
+		},
+	})
+	return c.prefix, material, product
+}
+
+type cost struct {
+	Materials []struct {
+		Quantity      float64 `json:"quantity"`
+		UnitCost      float64 `json:"unitCost"`
+		EffectiveFrom string  `json:"effectiveFrom"`
+		Cost          float64 `json:"cost"`
+	} `json:"materials"`
+	MaterialCost float64  `json:"materialCost"`
+	Labor        float64  `json:"labor"`
+	Overhead     float64  `json:"overhead"`
+	UnitCost     float64  `json:"unitCost"`
+	Margin       float64  `json:"margin"`
+	MarginPct    *float64 `json:"marginPct"`
+}
+
+func TestCost(t *testing.T) {
+	s := newTestServer(t)
+	prefix, _, product := s.pricedRing()
+
+	for _, test := range []struct {
+		date                                             string
+		unitCost, materialCost, total, margin, marginPct float64
+	}{
+		// 3.456 g with the waste
+		{"2026-03-01", 50, 172.8, 223.3, 76.7, 25.57},
+		{"2026-06-01", 60, 207.36, 257.86, 42.14, 14.05},
+	} {
+		var result cost
+		w := s.do(http.MethodGet, prefix+"/products/cost?id="+product+"&date="+test.date, nil)
+		expectStatus(t, w, http.StatusOK)
+		decode(t, w, &result)
+		if len(result.Materials) != 1 || result.Materials[0].Quantity != 3.456 || result.Materials[0].UnitCost != test.unitCost {
+			t.Errorf("%v: got materials %+v, want 3.456 g at %v", test.date, result.Materials, test.unitCost)
+		}
+		if result.MaterialCost != test.materialCost || result.Labor != 40 || result.Overhead != 10.5 || result.UnitCost != test.total {
+			t.Errorf("%v: got %+v, want %v of materials and %v in all", test.date, result, test.materialCost, test.total)
+		}
+		if result.Margin != test.margin || result.MarginPct == nil || *result.MarginPct != test.marginPct {
+			t.Errorf("%v: got margin %v (%v%%), want %v (%v%%)", test.date, result.Margin, result.MarginPct, test.margin, test.marginPct)
+		}
+	}
+}
+
+func TestCostMissing(t *testing.T) {
+	s := newTestServer(t)
+	prefix, material, product := s.pricedRing()
+
+	w := s.do(http.MethodGet, prefix+"/products/cost?id="+product+"&date=2025-12-31", nil)
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+	var body struct {
+		Materials []string `json:"materials"`
+	}
+	decode(t, w, &body)
+	if len(body.Materials) != 1 || body.Materials[0] != material {
+		t.Errorf("got materials %v without a cost, want [%v]", body.Materials, material)
+	}
+
+	w = s.do(http.MethodGet, prefix+"/products/cost?id="+product+"&date=31/12/2026", nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = s.do(http.MethodGet, prefix+"/products/cost?id="+missingID, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestWrongCosts(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+
+	for _, costs := range [][]map[string]interface{}{
+		{{"cost": -1, "unit": "g", "effectiveFrom": "2026-01-01"}},
+		{{"cost": 50, "unit": "oz", "effectiveFrom": "2026-01-01"}},
+		{{"cost": 50, "unit": "g", "effectiveFrom": "2026-01-01"}, {"cost": 55, "unit": "g", "effectiveFrom": "2026-01-01"}},
+	} {
+		w := s.do(http.MethodPost, c.prefix+"/materials/add", map[string]interface{}{"name": "Gold", "supplier": map[string]string{"id": c.supplier}, "costs": costs})
+		expectStatus(t, w, http.StatusBadRequest)
+	}
+	w := s.do(http.MethodPost, c.prefix+"/products/add", map[string]interface{}{
+		"name": "Ring", "materials": []map[string]string{{"id": c.material}}, "costs": []map[string]interface{}{{"kind": "shipping", "amount": 5}},
+	})
+	expectStatus(t, w, http.StatusBadRequest)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"marvinhagler/models"
+	"net/http"
+	"strings"
+)
+
+// expansion holds the nested objects a client asked to inline with ?expand=,
+// e.g. ?expand=materials or ?expand=none. Objects that are not expanded are
+// returned as {"id": ...} references. Without the parameter everything is inlined.
+type expansion map[string]bool
+
+// parseExpand reads ?expand= allowing only the given paths, expanding
+// materials.supplier implies expanding materials too
+func parseExpand(r *http.Request, paths ...string) (expansion, error) {
+	e := expansion{}
+	query := r.URL.Query()
+	if !query.Has("expand") {
+		for _, path := range paths {
+			e[path] = true
+		}
+		return e, nil
+	}
+
+	for _, path := range strings.Split(query.Get("expand"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" || path == "none" {
+			continue
+		}
+		known := false
+		for _, allowed := range paths {
+			known = known || allowed == path
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown expand value %q, use none or %v", path, strings.Join(paths, ","))
+		}
+		for i := range path {
+			if path[i] == '.' {
+				e[path[:i]] = true
+			}
+		}
+		e[path] = true
+	}
+	return e, nil
+}
+
+type reference struct {
+	Id string `json:"id"`
+}
+
+type materialView struct {
+	models.Material
+	Supplier interface{} `json:"supplier"`
+}
+
+type productView struct {
+	models.Product
+	Materials []interface{} `json:"materials"`
+}
+
+// material renders material, prefix is the path of the material in the
+// response ("" or "materials.")
+func (e expansion) material(material models.Material, prefix string) materialView {
+	view := materialView{Material: material, Supplier: reference{material.Supplier.Id}}
+	if e[prefix+"supplier"] {
+		view.Supplier = material.Supplier
+	}
+	return view
+}
+
+func (e expansion) materials(materials []models.Material) []materialView {
+	if materials == nil {
+		return nil
+	}
+	views := make([]materialView, 0, len(materials))
+	for _, material := range materials {
+		views = append(views, e.material(material, ""))
+	}
+	return views
+}
+
+func (e expansion) product(product models.Product) productView {
+	view := productView{Product: product, Materials: make([]interface{}, 0, len(product.Materials))}
+	for _, material := range product.Materials {
+		if e["materials"] {
+			view.Materials = append(view.Materials, e.material(material, "materials."))
+		} else {
+			view.Materials = append(view.Materials, reference{material.Id})
+		}
+	}
+	return view
+}
+
+func (e expansion) products(products []models.Product) []productView {
+	if products == nil {
+		return nil
+	}
+	views := make([]productView, 0, len(products))
+	for _, product := range products {
+		views = append(views, e.product(product))
+	}
+	return views
+}
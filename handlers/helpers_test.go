@@ -0,0 +1,135 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"marvinhagler/handlers"
+	"marvinhagler/helpers"
+	"marvinhagler/middleware"
+	"marvinhagler/models"
+	"marvinhagler/routes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// The handler tests run the routes the way main.go serves them, scoped to a
+// company, on the memory backend.
+
+const adminKey = "test-admin-key"
+
+// missingID has the format of an ID and names nothing
+const missingID = "X-0000000000000000000"
+
+type testServer struct {
+	t       *testing.T
+	repos   *models.Repositories
+	handler http.Handler
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	repos := models.NewMemoryRepositories(models.ReferenceByID)
+
+	mux := http.NewServeMux()
+	routes.ProductsRouter(mux, &handlers.ProductsEnv{Products: repos.Products, Materials: repos.Materials, Lots: repos.Lots, Certs: repos.Certs, Audit: repos.Audit})
+	routes.MaterialsRouter(mux, &handlers.MaterialsEnv{Materials: repos.Materials, Products: repos.Products, Suppliers: repos.Suppliers, Lots: repos.Lots, Certs: repos.Certs, Audit: repos.Audit})
+	routes.SuppliersRouter(mux, &handlers.SuppliersEnv{Suppliers: repos.Suppliers, Materials: repos.Materials, Products: repos.Products, Lots: repos.Lots, Certs: repos.Certs, Audit: repos.Audit})
+	routes.LotsRouter(mux, &handlers.LotsEnv{Lots: repos.Lots, Materials: repos.Materials, Suppliers: repos.Suppliers, Products: repos.Products, Certs: repos.Certs, Audit: repos.Audit})
+	routes.CertsRouter(mux, &handlers.CertsEnv{Certs: repos.Certs, Suppliers: repos.Suppliers, Materials: repos.Materials, Products: repos.Products, Lots: repos.Lots, Audit: repos.Audit})
+	routes.TraceRouter(mux, &handlers.TraceEnv{Lots: repos.Lots, Products: repos.Products, Materials: repos.Materials, Suppliers: repos.Suppliers})
+	routes.CompanyRouter(mux, &handlers.CompanyEnv{Company: repos.Company})
+	routes.KeysRouter(mux, &handlers.KeysEnv{Keys: repos.APIKeys})
+	routes.AuditRouter(mux, &handlers.AuditEnv{Audit: repos.Audit})
+	routes.TrashRouter(mux, &handlers.TrashEnv{Trash: repos.Trash, Products: repos.Products, Materials: repos.Materials, Suppliers: repos.Suppliers, Lots: repos.Lots, Certs: repos.Certs})
+
+	auth := &middleware.Authenticator{Keys: repos.APIKeys, Sessions: repos.Sessions, Users: repos.Users, AdminKeyHash: helpers.HashSecret(adminKey)}
+	return &testServer{t: t, repos: repos, handler: auth.Wrap(middleware.Tenancy(repos.Company, []string{"/company/", "/auth/"}, mux))}
+}
+
+// do sends a request with the admin key and body encoded as JSON, headers
+// come in name, value pairs
+func (s *testServer) do(method, path string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.doWith(adminKey, method, path, body, headers...)
+}
+
+// doWith sends a request with key
+func (s *testServer) doWith(key, method, path string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	r := httptest.NewRequest(method, path, reader)
+	r.Header.Set("X-API-Key", key)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+	return w
+}
+
+// company creates a company and returns the prefix of its routes
+func (s *testServer) company(name string) string {
+	s.t.Helper()
+	w := s.do(http.MethodPost, "/company/init", map[string]string{"name": name})
+	expectStatus(s.t, w, http.StatusCreated)
+	var company struct {
+		Id string `json:"_id"`
+	}
+	decode(s.t, w, &company)
+	return "/companies/" + company.Id
+}
+
+// key creates an API key of the company behind prefix with role
+func (s *testServer) key(prefix string, role models.Role) string {
+	s.t.Helper()
+	w := s.do(http.MethodPost, prefix+"/keys/create", map[string]string{"name": string(role), "role": string(role)})
+	expectStatus(s.t, w, http.StatusCreated)
+	var created struct {
+		Key string `json:"key"`
+	}
+	decode(s.t, w, &created)
+	return created.Key
+}
+
+// add posts body to path and returns the ID of the new record
+func (s *testServer) add(path string, body interface{}) string {
+	s.t.Helper()
+	w := s.do(http.MethodPost, path, body)
+	expectStatus(s.t, w, http.StatusCreated)
+	var record struct {
+		Id string `json:"id"`
+	}
+	decode(s.t, w, &record)
+	return record.Id
+}
+
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("got status %d, want %d: %s", w.Code, status, strings.TrimSpace(w.Body.String()))
+	}
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
+
+// ifMatch is the If-Match header sending version
+func ifMatch(version int) []string {
+	return []string{"If-Match", fmt.Sprintf(`"%d"`, version)}
+}
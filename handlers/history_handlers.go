@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"marvinhagler/models"
+	"net/http"
+	"time"
+)
+
+// parseAt reads ?at=, a time like 2026-01-01T00:00:00Z asking for a record as
+// it was back then. Without the parameter the time is zero. The revision is
+// the record as last written by its own add or update: the copies of
+// materials and suppliers embedded in it are as they were then, later updates
+// propagated to them are not in the audit log.
+func parseAt(r *http.Request) (time.Time, error) {
+	value := r.URL.Query().Get("at")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Wrong at format, use a time like 2026-01-01T00:00:00Z")
+	}
+	return at, nil
+}
+
+func (env *AuditEnv) GetHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /history?id=my_id
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		revisions, err := models.Revisions(r.Context(), env.Audit, id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(revisions)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
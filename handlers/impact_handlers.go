@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"marvinhagler/models"
+	"net/http"
+)
+
+// A recall starts from a supplier, a material or a lot and reaches every
+// material, lot and product it went into. Produced items are not tracked one
+// by one, so products are the end of the chain.
+
+type impactSource struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+type impactCounts struct {
+	Materials int `json:"materials"`
+	Lots      int `json:"lots"`
+	Products  int `json:"products"`
+}
+
+type impactReport struct {
+	Source    impactSource      `json:"source"`
+	Counts    impactCounts      `json:"counts"`
+	Materials []models.Material `json:"materials"`
+	Lots      []models.Lot      `json:"lots"`
+	Products  []models.Product  `json:"products"`
+}
+
+// impactQuery reads which of supplier_id, material_id or lot_id the recall
+// starts from, exactly one of them must be sent
+func impactQuery(r *http.Request) (impactSource, error) {
+	var source impactSource
+	for _, param := range []struct{ name, entity string }{
+		{"supplier_id", models.EntitySupplier},
+		{"material_id", models.EntityMaterial},
+		{"lot_id", models.EntityLot},
+	} {
+		id := r.URL.Query().Get(param.name)
+		if id == "" {
+			continue
+		}
+		if source.Id != "" {
+			return source, errors.New("send only one of supplier_id, material_id or lot_id")
+		}
+		if len(id) < 20 || len(id) > 25 {
+			return source, errors.New("Wrong ID format")
+		}
+		source = impactSource{Type: param.entity, Id: id}
+	}
+	if source.Id == "" {
+		return source, errors.New("send one of supplier_id, material_id or lot_id")
+	}
+	return source, nil
+}
+
+// impact collects what the recall of source reaches
+func (env *TraceEnv) impact(ctx context.Context, source impactSource) (*impactReport, error) {
+	report := &impactReport{Source: source, Materials: []models.Material{}, Lots: []models.Lot{}, Products: []models.Product{}}
+	seen := map[string]bool{}
+	addMaterial := func(material models.Material) {
+		if !seen[material.Id] {
+			seen[material.Id] = true
+			report.Materials = append(report.Materials, material)
+		}
+	}
+	addProducts := func(products []models.Product) {
+		for _, product := range products {
+			if !seen[product.Id] {
+				seen[product.Id] = true
+				report.Products = append(report.Products, product)
+			}
+		}
+	}
+
+	switch source.Type {
+	case models.EntitySupplier:
+		if _, err := env.Suppliers.GetOne(ctx, source.Id); err != nil {
+			return nil, err
+		}
+		materials, err := materialsBySupplier(ctx, env.Materials, source.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, material := range materials {
+			addMaterial(material)
+			products, err := productsByMaterial(ctx, env.Products, material.Id)
+			if err != nil {
+				return nil, err
+			}
+			addProducts(products)
+		}
+		lots, err := env.Lots.GetAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, lot := range lots {
+			if lot.SupplierID != source.Id {
+				continue
+			}
+			report.Lots = append(report.Lots, lot)
+			// the lot can be of a material bought from another supplier
+			if !seen[lot.MaterialID] {
+				material, err := env.Materials.GetOne(ctx, lot.MaterialID)
+				if err != nil {
+					return nil, err
+				}
+				addMaterial(*material)
+			}
+			products, err := env.Products.GetByLot(ctx, lot.Id)
+			if err != nil {
+				return nil, err
+			}
+			addProducts(products)
+		}
+	case models.EntityMaterial:
+		material, err := env.Materials.GetOne(ctx, source.Id)
+		if err != nil {
+			return nil, err
+		}
+		report.Materials = append(report.Materials, *material)
+		lots, err := env.Lots.GetByMaterial(ctx, source.Id)
+		if err != nil {
+			return nil, err
+		}
+		report.Lots = append(report.Lots, lots...)
+		products, err := productsByMaterial(ctx, env.Products, source.Id)
+		if err != nil {
+			return nil, err
+		}
+		addProducts(products)
+	case models.EntityLot:
+		// only the products made from the lot are reached, not every
+		// product made with its material
+		lot, err := env.Lots.GetOne(ctx, source.Id)
+		if err != nil {
+			return nil, err
+		}
+		report.Lots = append(report.Lots, *lot)
+		material, err := env.Materials.GetOne(ctx, lot.MaterialID)
+		if err != nil {
+			return nil, err
+		}
+		report.Materials = append(report.Materials, *material)
+		products, err := env.Products.GetByLot(ctx, source.Id)
+		if err != nil {
+			return nil, err
+		}
+		addProducts(products)
+	}
+
+	report.Counts = impactCounts{Materials: len(report.Materials), Lots: len(report.Lots), Products: len(report.Products)}
+	return report, nil
+}
+
+// writeImpactCSV sends report as a CSV file to download, one row per record
+func writeImpactCSV(w http.ResponseWriter, report *impactReport) error {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="impact-%v.csv"`, report.Source.Id))
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"type", "id", "name", "material_id", "supplier_id", "details"})
+	for _, material := range report.Materials {
+		out.Write([]string{models.EntityMaterial, material.Id, material.Name, "", material.Supplier.Id, material.Origin})
+	}
+	for _, lot := range report.Lots {
+		details := fmt.Sprintf("%v %v received %v, assay %v", lot.Quantity, lot.Unit, lot.ReceivedAt, lot.Assay)
+		out.Write([]string{models.EntityLot, lot.Id, "", lot.MaterialID, lot.SupplierID, details})
+	}
+	for _, product := range report.Products {
+		out.Write([]string{models.EntityProduct, product.Id, product.Name, "", "", product.MadeIn})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func (env *TraceEnv) TraceImpactHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /trace/impact?supplier_id=id|material_id=id|lot_id=id[&format=csv]
+		source, err := impactQuery(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "csv" {
+			http.Error(w, fmt.Sprintf("Unknown format %q, use json or csv", format), http.StatusBadRequest)
+			return
+		}
+
+		report, err := env.impact(r.Context(), source)
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if format == "csv" {
+			if err := writeImpactCSV(w, report); err != nil {
+				log.Println("Failed to encode response:", err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(report)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
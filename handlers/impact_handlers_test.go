@@ -0,0 +1,80 @@
+package handlers_test
+
+import (
+	"marvinhagler/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type impact struct {
+	Counts struct {
+		Materials int `json:"materials"`
+		Lots      int `json:"lots"`
+		Products  int `json:"products"`
+	} `json:"counts"`
+	Materials []models.Material `json:"materials"`
+	Lots      []models.Lot      `json:"lots"`
+	Products  []models.Product  `json:"products"`
+}
+
+func TestSupplierImpact(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	lot := s.lot(c.prefix, c.material)
+	band := s.add(c.prefix+"/products/add", map[string]interface{}{
+		"name": "Band", "materials": []map[string]string{{"id": c.material}}, "lots": []string{lot},
+	})
+
+	var report impact
+	w := s.do(http.MethodGet, c.prefix+"/trace/impact?supplier_id="+c.supplier, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &report)
+	if report.Counts.Materials != 1 || report.Counts.Lots != 1 || report.Counts.Products != 2 {
+		t.Errorf("got counts %+v, want 1 material, 1 lot and 2 products", report.Counts)
+	}
+	if len(report.Lots) != 1 || report.Lots[0].Id != lot {
+		t.Errorf("got lots %+v, want %v", report.Lots, lot)
+	}
+	for _, product := range report.Products {
+		if product.Id != c.product && product.Id != band {
+			t.Errorf("got product %v, want %v and %v", product.Id, c.product, band)
+		}
+	}
+
+	w = s.do(http.MethodGet, c.prefix+"/trace/impact?lot_id="+lot+"&format=csv", nil)
+	expectStatus(t, w, http.StatusOK)
+	if !strings.Contains(w.Body.String(), band) || strings.Contains(w.Body.String(), c.product) {
+		t.Errorf("got csv %q, want only the product made from lot %v", w.Body.String(), lot)
+	}
+
+	w = s.do(http.MethodGet, c.prefix+"/trace/impact?supplier_id="+missingID, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = s.do(http.MethodGet, c.prefix+"/trace/impact?supplier_id="+c.supplier+"&lot_id="+lot, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestSupplierImpactDeliveredLots(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	broker := s.add(c.prefix+"/suppliers/add", map[string]string{"name": "Bullion broker", "country": "CH"})
+	// the broker delivered a lot of a material bought from Gold Co
+	lot := s.add(c.prefix+"/lots/add", map[string]interface{}{"materialId": c.material, "supplierId": broker, "quantity": 100, "unit": "g", "receivedAt": "2026-01-10"})
+	product := s.add(c.prefix+"/products/add", map[string]interface{}{
+		"name": "Band", "materials": []map[string]string{{"id": c.material}}, "lots": []string{lot},
+	})
+
+	var report impact
+	w := s.do(http.MethodGet, c.prefix+"/trace/impact?supplier_id="+broker, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &report)
+	if len(report.Materials) != 1 || report.Materials[0].Id != c.material {
+		t.Errorf("got materials %+v, want %v", report.Materials, c.material)
+	}
+	if len(report.Lots) != 1 || report.Lots[0].Id != lot {
+		t.Errorf("got lots %+v, want %v", report.Lots, lot)
+	}
+	if len(report.Products) != 1 || report.Products[0].Id != product {
+		t.Errorf("got products %+v, want %v", report.Products, product)
+	}
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"marvinhagler/models"
+	"net/http"
+)
+
+// Suppliers and materials can only be deleted once nothing points to them.
+// Deletes accept ?cascade=true, which also deletes the dependents, or
+// ?reassign=<id>, which points the dependents to another record first. Lots
+// products were made from keep their material: a material with such lots can
+// be deleted with its products but not reassigned. Certifications about a
+// supplier, material, product or lot also keep it from being deleted, unless
+// with ?cascade=true which deletes them too, products and lots included.
+// Dependents are changed one
+// at a time, without a transaction: when one fails the answer lists those
+// already changed, the deleted ones can be restored from the trash.
+
+type conflictResponse struct {
+	Error     string   `json:"error"`
+	Materials []string `json:"materials,omitempty"`
+	Products  []string `json:"products,omitempty"`
+	Lots      []string `json:"lots,omitempty"`
+	Certs     []string `json:"certs,omitempty"`
+}
+
+type deleteResult struct {
+	Message             string   `json:"message"`
+	DeletedMaterials    []string `json:"deleted_materials,omitempty"`
+	DeletedProducts     []string `json:"deleted_products,omitempty"`
+	DeletedLots         []string `json:"deleted_lots,omitempty"`
+	DeletedCerts        []string `json:"deleted_certs,omitempty"`
+	ReassignedMaterials []string `json:"reassigned_materials,omitempty"`
+	ReassignedProducts  []string `json:"reassigned_products,omitempty"`
+	ReassignedLots      []string `json:"reassigned_lots,omitempty"`
+}
+
+// deleteMode reads ?cascade= and ?reassign=, they cannot be used together
+func deleteMode(r *http.Request) (cascade bool, reassign string, err error) {
+	query := r.URL.Query()
+	cascade = query.Get("cascade") == "true"
+	reassign = query.Get("reassign")
+	if cascade && reassign != "" {
+		return false, "", errors.New("use either cascade or reassign, not both")
+	}
+	if reassign != "" && (len(reassign) < 20 || len(reassign) > 25) {
+		return false, "", errors.New("Wrong reassign ID format")
+	}
+	return cascade, reassign, nil
+}
+
+// materialsBySupplier returns the materials of supplier, none is not an error
+func materialsBySupplier(ctx context.Context, materials models.MaterialRepository, supplierID string) ([]models.Material, error) {
+	found, err := materials.GetBySupplier(ctx, supplierID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return *found, nil
+}
+
+// productsByMaterial returns the products made with material, none is not an error
+func productsByMaterial(ctx context.Context, products models.ProductRepository, materialID string) ([]models.Product, error) {
+	found, err := products.GetByMaterial(ctx, materialID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return *found, nil
+}
+
+// appendUnique appends id to ids unless already there
+func appendUnique(ids []string, id string) []string {
+	for _, existing := range ids {
+		if existing == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+// materialDependents returns the IDs of the products made with material
+func materialDependents(ctx context.Context, products models.ProductRepository, materialID string) ([]string, error) {
+	dependents, err := productsByMaterial(ctx, products, materialID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, product := range dependents {
+		ids = appendUnique(ids, product.Id)
+	}
+	return ids, nil
+}
+
+// usedLots returns the IDs of the lots products were made from and of those
+// products
+func usedLots(ctx context.Context, products models.ProductRepository, lots []models.Lot) ([]string, []string, error) {
+	var lotIDs, productIDs []string
+	for _, lot := range lots {
+		users, err := products.GetByLot(ctx, lot.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(users) > 0 {
+			lotIDs = append(lotIDs, lot.Id)
+		}
+		for _, product := range users {
+			productIDs = appendUnique(productIDs, product.Id)
+		}
+	}
+	return lotIDs, productIDs, nil
+}
+
+// lotIDs returns the IDs of lots
+func lotIDs(lots []models.Lot) []string {
+	var ids []string
+	for _, lot := range lots {
+		ids = append(ids, lot.Id)
+	}
+	return ids
+}
+
+// deleteLotsOf deletes the lots of the materials with materialIDs, once the
+// products made from them are gone, and returns their IDs
+func deleteLotsOf(ctx context.Context, lots models.LotRepository, materialIDs []string) ([]string, error) {
+	var deleted []string
+	for _, materialID := range materialIDs {
+		found, err := lots.GetByMaterial(ctx, materialID)
+		if err != nil {
+			return deleted, err
+		}
+		for _, lot := range found {
+			if err := lots.DeleteOne(ctx, lot.Id); err != nil {
+				return deleted, err
+			}
+			deleted = append(deleted, lot.Id)
+		}
+	}
+	return deleted, nil
+}
+
+// lotsOf returns the lots of the materials with materialIDs
+func lotsOf(ctx context.Context, lots models.LotRepository, materialIDs []string) ([]models.Lot, error) {
+	var all []models.Lot
+	for _, materialID := range materialIDs {
+		found, err := lots.GetByMaterial(ctx, materialID)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, found...)
+	}
+	return all, nil
+}
+
+// certsAbout returns the IDs of the certifications about the records with
+// subjectIDs
+func certsAbout(ctx context.Context, certs models.CertRepository, subjectIDs []string) ([]string, error) {
+	var ids []string
+	for _, subjectID := range subjectIDs {
+		found, err := certs.GetBySubject(ctx, subjectID)
+		if errors.Is(err, models.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range *found {
+			ids = appendUnique(ids, cert.Id)
+		}
+	}
+	return ids, nil
+}
+
+// deleteCerts deletes the certifications with ids and returns those deleted,
+// up to the failed one
+func deleteCerts(ctx context.Context, certs models.CertRepository, ids []string) ([]string, error) {
+	var deleted []string
+	for _, id := range ids {
+		if err := certs.DeleteOne(ctx, id); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, id)
+	}
+	return deleted, nil
+}
+
+// supplierDependents returns the IDs of the materials of supplier and of the
+// products made with them
+func supplierDependents(ctx context.Context, materials models.MaterialRepository, products models.ProductRepository, supplierID string) ([]string, []string, error) {
+	dependents, err := materialsBySupplier(ctx, materials, supplierID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var materialIDs, productIDs []string
+	for _, material := range dependents {
+		materialIDs = appendUnique(materialIDs, material.Id)
+		ids, err := materialDependents(ctx, products, material.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, id := range ids {
+			productIDs = appendUnique(productIDs, id)
+		}
+	}
+	return materialIDs, productIDs, nil
+}
+
+// replaceMaterial points the materials of product with materialID to
+// replacement, without listing replacement twice. Its bill of materials lines
+// keep their quantities and move to replacement, merged with the lines of
+// replacement in the same unit. The lots of product are left alone, callers
+// refuse to reassign a material products were made from lots of.
+func replaceMaterial(product models.Product, materialID string, replacement models.Material) models.Product {
+	materials := make([]models.Material, 0, len(product.Materials))
+	used := false
+	for _, material := range product.Materials {
+		if material.Id == materialID || material.Id == replacement.Id {
+			if used {
+				continue
+			}
+			material, used = replacement, true
+		}
+		materials = append(materials, material)
+	}
+	product.Materials = materials
+
+	bom := make([]models.BOMLine, 0, len(product.BOM))
+	merged := map[models.Unit]int{}
+	for _, line := range product.BOM {
+		if line.MaterialID == materialID {
+			line.MaterialID = replacement.Id
+		}
+		if line.MaterialID != replacement.Id {
+			bom = append(bom, line)
+			continue
+		}
+		if i, ok := merged[line.Unit]; ok {
+			bom[i] = mergeBOMLines(bom[i], line)
+			continue
+		}
+		merged[line.Unit] = len(bom)
+		bom = append(bom, line)
+	}
+	product.BOM = bom
+	return product
+}
+
+func writeConflict(w http.ResponseWriter, conflict conflictResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+
+	err := json.NewEncoder(w).Encode(conflict)
+	if err != nil {
+		log.Println("Failed to encode response:", err)
+	}
+}
+
+// changed tells whether a dependent was already deleted or reassigned
+func (r deleteResult) changed() bool {
+	return len(r.DeletedMaterials) > 0 || len(r.DeletedProducts) > 0 || len(r.DeletedLots) > 0 || len(r.DeletedCerts) > 0 ||
+		len(r.ReassignedMaterials) > 0 || len(r.ReassignedProducts) > 0 || len(r.ReassignedLots) > 0
+}
+
+// writePartialDelete answers a delete that failed part way with err and the
+// dependents result already deleted or reassigned
+func writePartialDelete(w http.ResponseWriter, result deleteResult, err error) {
+	result.Message = fmt.Sprintf("Delete failed, the dependents listed were already changed: %v", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Println("Failed to encode response:", err)
+	}
+}
+
+// deleteError answers with the status matching an error returned by a delete
+func deleteError(w http.ResponseWriter, err error) {
+	thisErr := fmt.Sprintf("%v", err)
+	if errors.Is(err, models.ErrConflict) {
+		http.Error(w, thisErr, http.StatusConflict)
+		return
+	}
+	http.Error(w, thisErr, http.StatusBadRequest)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"marvinhagler/helpers"
+	"marvinhagler/models"
+	"net/http"
+	"time"
+)
+
+type KeysEnv struct {
+	Keys models.APIKeyRepository
+}
+
+// createdKey is the answer to a new key, the only time the key itself is shown
+type createdKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+func (env *KeysEnv) CreateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var keyData models.APIKey
+
+		err := json.NewDecoder(r.Body).Decode(&keyData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("JSON Error: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		// keys get every permission of the company unless told otherwise
+		if keyData.Role == "" {
+			keyData.Role = models.RoleAdmin
+		}
+		if !keyData.Role.Valid() {
+			http.Error(w, fmt.Sprintf("Unknown role %q", keyData.Role), http.StatusBadRequest)
+			return
+		}
+
+		secret, err := helpers.GenerateSecret("wt_")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		newKey := models.APIKey{
+			Id:        helpers.GenerateId("K-"),
+			Name:      keyData.Name,
+			Prefix:    secret[:11],
+			Role:      keyData.Role,
+			Hash:      helpers.HashSecret(secret),
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		}
+
+		err = env.Keys.Add(r.Context(), newKey)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+
+		err = json.NewEncoder(w).Encode(createdKey{APIKey: newKey, Key: secret})
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *KeysEnv) GetAllKeysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := env.Keys.GetAll(r.Context())
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(keys)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *KeysEnv) RevokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		// /revoke?id=my_id
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		err := env.Keys.Revoke(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode("API key revoked")
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"marvinhagler/helpers"
+	"marvinhagler/models"
+	"net/http"
+	"time"
+)
+
+type LotsEnv struct {
+	Lots      models.LotRepository
+	Materials models.MaterialRepository
+	Suppliers models.SupplierRepository
+	Products  models.ProductRepository
+	Certs     models.CertRepository
+	Audit     models.AuditRepository
+}
+
+// checkLot checks the quantity, unit and receipt date of lot
+func checkLot(lot models.Lot) error {
+	if lot.Quantity <= 0 {
+		return errors.New("quantity must be greater than 0")
+	}
+	if !lot.Unit.Valid() {
+		return fmt.Errorf("unknown unit %q, use one of %v", lot.Unit, models.Units)
+	}
+	if _, err := time.Parse(models.CertDateLayout, lot.ReceivedAt); err != nil {
+		return fmt.Errorf("wrong receivedAt %q, use YYYY-MM-DD", lot.ReceivedAt)
+	}
+	return nil
+}
+
+func (env *LotsEnv) AddLotHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var lotData models.Lot
+
+		err := json.NewDecoder(r.Body).Decode(&lotData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("JSON Error: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		lotData.Id = helpers.GenerateId("LOT-")
+		lotData.Version = 1
+
+		err = checkLot(lotData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		unknown, err := lotReferences(r.Context(), env.Materials, env.Suppliers, &lotData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if unknown != nil {
+			writeUnknownReferences(w, *unknown)
+			return
+		}
+
+		err = env.Lots.Add(r.Context(), lotData)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		setETag(w, lotData.Version)
+		w.WriteHeader(http.StatusCreated)
+
+		err = json.NewEncoder(w).Encode(lotData)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+
+}
+
+func (env *LotsEnv) UpdateLotHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		var lotData models.Lot
+
+		err := json.NewDecoder(r.Body).Decode(&lotData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("JSON Error: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		version, ok := ifMatch(w, r)
+		if !ok {
+			return
+		}
+		lotData.Version = version
+
+		err = checkLot(lotData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		// products made from the lot keep it, a lot of another material
+		// would change what they were made of
+		current, err := env.Lots.GetOne(r.Context(), lotData.Id)
+		if err != nil {
+			updateError(w, err)
+			return
+		}
+		if current.MaterialID != lotData.MaterialID {
+			products, err := env.Products.GetByLot(r.Context(), lotData.Id)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				return
+			}
+			if len(products) > 0 {
+				var productIDs []string
+				for _, product := range products {
+					productIDs = append(productIDs, product.Id)
+				}
+				writeConflict(w, conflictResponse{
+					Error:    fmt.Sprintf("lot %v was used by %d products, its material cannot change", lotData.Id, len(productIDs)),
+					Products: productIDs,
+				})
+				return
+			}
+		}
+
+		unknown, err := lotReferences(r.Context(), env.Materials, env.Suppliers, &lotData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if unknown != nil {
+			writeUnknownReferences(w, *unknown)
+			return
+		}
+
+		err = env.Lots.Update(r.Context(), lotData)
+		if err != nil {
+			updateError(w, err)
+			return
+		}
+		lotData.Version++
+
+		w.Header().Set("Content-Type", "application/json")
+		setETag(w, lotData.Version)
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(lotData)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+
+}
+
+func (env *LotsEnv) GetAllLotsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		lots, err := env.Lots.GetAll(r.Context())
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(lots)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *LotsEnv) GetOneLotHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /find-lot?id=my_id[&at=2026-01-01T00:00:00Z]
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		at, err := parseAt(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		var lot *models.Lot
+		if at.IsZero() {
+			lot, err = env.Lots.GetOne(r.Context(), id)
+		} else {
+			lot = &models.Lot{}
+			err = models.RecordAt(r.Context(), env.Audit, models.EntityLot, id, at, lot)
+		}
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if at.IsZero() {
+			setETag(w, lot.Version)
+		}
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(lot)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *LotsEnv) GetLotsByMaterialHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /find-by-material?material_id=id
+		id := r.URL.Query().Get("material_id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		lots, err := env.Lots.GetByMaterial(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(lots)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *LotsEnv) DeleteOneLotHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		// /delete-lot?id=my_id[&cascade=true]
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+		cascade := r.URL.Query().Get("cascade") == "true"
+
+		_, err := env.Lots.GetOne(r.Context(), id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		dependents, err := env.Products.GetByLot(r.Context(), id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(dependents) > 0 {
+			var productIDs []string
+			for _, product := range dependents {
+				productIDs = appendUnique(productIDs, product.Id)
+			}
+			writeConflict(w, conflictResponse{
+				Error:    fmt.Sprintf("lot %v was used by %d products", id, len(productIDs)),
+				Products: productIDs,
+			})
+			return
+		}
+
+		certIDs, err := certsAbout(r.Context(), env.Certs, []string{id})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(certIDs) > 0 && !cascade {
+			writeConflict(w, conflictResponse{
+				Error: fmt.Sprintf("lot %v has %d certifications", id, len(certIDs)),
+				Certs: certIDs,
+			})
+			return
+		}
+		result := deleteResult{Message: "Lot deleted"}
+		result.DeletedCerts, err = deleteCerts(r.Context(), env.Certs, certIDs)
+		if err != nil {
+			writePartialDelete(w, result, err)
+			return
+		}
+
+		err = env.Lots.DeleteOne(r.Context(), id)
+		if err != nil && result.changed() {
+			writePartialDelete(w, result, err)
+			return
+		}
+		if err != nil {
+			deleteError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if cascade {
+			err = json.NewEncoder(w).Encode(result)
+		} else {
+			err = json.NewEncoder(w).Encode("Lot deleted")
+		}
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers_test
+
+import (
+	"marvinhagler/models"
+	"net/http"
+	"testing"
+)
+
+// lot receives 100 g of material
+func (s *testServer) lot(prefix, material string) string {
+	s.t.Helper()
+	return s.add(prefix+"/lots/add", map[string]interface{}{"materialId": material, "quantity": 100, "unit": "g", "receivedAt": "2026-01-10"})
+}
+
+func TestAddLotUnknownMaterial(t *testing.T) {
+	s := newTestServer(t)
+	prefix := s.company("acme")
+
+	w := s.do(http.MethodPost, prefix+"/lots/add", map[string]interface{}{"materialId": missingID, "quantity": 100, "unit": "g", "receivedAt": "2026-01-10"})
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+	w = s.do(http.MethodPost, prefix+"/lots/add", map[string]interface{}{"materialId": missingID, "quantity": 100, "unit": "oz", "receivedAt": "2026-01-10"})
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestTraceLot(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	lot := s.lot(c.prefix, c.material)
+	product := s.add(c.prefix+"/products/add", map[string]interface{}{
+		"name": "Band", "materials": []map[string]string{{"id": c.material}}, "lots": []string{lot},
+	})
+
+	var forward struct {
+		Lot struct {
+			Id       string           `json:"id"`
+			Supplier *models.Supplier `json:"supplier"`
+		} `json:"lot"`
+		Products []models.Product `json:"products"`
+	}
+	w := s.do(http.MethodGet, c.prefix+"/trace/forward?lot_id="+lot, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &forward)
+	if forward.Lot.Supplier == nil || forward.Lot.Supplier.Id != c.supplier {
+		t.Errorf("got lot %+v, want it delivered by %v", forward.Lot, c.supplier)
+	}
+	if len(forward.Products) != 1 || forward.Products[0].Id != product {
+		t.Errorf("got products %+v, want %v", forward.Products, product)
+	}
+
+	var backward struct {
+		Lots      []struct{ Id string } `json:"lots"`
+		Suppliers []models.Supplier     `json:"suppliers"`
+	}
+	w = s.do(http.MethodGet, c.prefix+"/trace/backward?product_id="+product, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &backward)
+	if len(backward.Lots) != 1 || backward.Lots[0].Id != lot || len(backward.Suppliers) != 1 || backward.Suppliers[0].Id != c.supplier {
+		t.Errorf("got %+v, want lot %v of %v", backward, lot, c.supplier)
+	}
+}
+
+func TestProductLots(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	silver := s.add(c.prefix+"/materials/add", map[string]interface{}{"name": "Silver", "supplier": map[string]string{"id": c.supplier}})
+	lot := s.lot(c.prefix, silver)
+
+	// the product is not made of silver
+	w := s.do(http.MethodPost, c.prefix+"/products/add", map[string]interface{}{
+		"name": "Band", "materials": []map[string]string{{"id": c.material}}, "lots": []string{lot},
+	})
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+	w = s.do(http.MethodPost, c.prefix+"/products/add", map[string]interface{}{
+		"name": "Band", "materials": []map[string]string{{"id": c.material}}, "lots": []string{missingID},
+	})
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+}
+
+func TestDeleteUsedLot(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	lot := s.lot(c.prefix, c.material)
+	product := s.add(c.prefix+"/products/add", map[string]interface{}{
+		"name": "Band", "materials": []map[string]string{{"id": c.material}}, "lots": []string{lot},
+	})
+
+	w := s.do(http.MethodDelete, c.prefix+"/lots/delete-lot?id="+lot, nil)
+	expectStatus(t, w, http.StatusConflict)
+	var body conflict
+	decode(t, w, &body)
+	if len(body.Products) != 1 || body.Products[0] != product {
+		t.Errorf("got products %v, want [%v]", body.Products, product)
+	}
+
+	w = s.do(http.MethodDelete, c.prefix+"/products/delete-product?id="+product, nil)
+	expectStatus(t, w, http.StatusOK)
+	w = s.do(http.MethodDelete, c.prefix+"/lots/delete-lot?id="+lot, nil)
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestUpdateUsedLot(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	silver := s.add(c.prefix+"/materials/add", map[string]interface{}{"name": "Silver", "supplier": map[string]string{"id": c.supplier}})
+	lot := s.lot(c.prefix, c.material)
+	s.add(c.prefix+"/products/add", map[string]interface{}{
+		"name": "Band", "materials": []map[string]string{{"id": c.material}}, "lots": []string{lot},
+	})
+
+	w := s.do(http.MethodPut, c.prefix+"/lots/update", map[string]interface{}{
+		"id": lot, "materialId": silver, "quantity": 100, "unit": "g", "receivedAt": "2026-01-10",
+	}, ifMatch(1)...)
+	expectStatus(t, w, http.StatusConflict)
+
+	// other changes to a used lot are fine
+	w = s.do(http.MethodPut, c.prefix+"/lots/update", map[string]interface{}{
+		"id": lot, "materialId": c.material, "quantity": 90, "unit": "g", "receivedAt": "2026-01-10",
+	}, ifMatch(1)...)
+	expectStatus(t, w, http.StatusOK)
+
+	var updated models.Lot
+	w = s.do(http.MethodGet, c.prefix+"/lots/find-lot?id="+lot, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &updated)
+	if updated.MaterialID != c.material || updated.Quantity != 90 {
+		t.Errorf("got %+v, want 90 g of %v", updated, c.material)
+	}
+}
@@ -7,10 +7,44 @@ import (
 	"marvinhagler/helpers"
 	"marvinhagler/models"
 	"net/http"
+	"time"
 )
 
 type MaterialsEnv struct {
-	Materials *models.MaterialModel
+	Materials models.MaterialRepository
+	Products  models.ProductRepository
+	Suppliers models.SupplierRepository
+	Lots      models.LotRepository
+	Certs     models.CertRepository
+	Audit     models.AuditRepository
+}
+
+// checkProvenance checks the chain of custody of material is made of known
+// stages in chain order, with dates like 2024-12-31 that do not go back in time
+func checkProvenance(material models.Material) error {
+	last, lastDate := 0, time.Time{}
+	for i, step := range material.Provenance {
+		order := models.StageOrder(step.Stage)
+		if order < 0 {
+			return fmt.Errorf("unknown stage %q in provenance step %d, use one of %v", step.Stage, i+1, models.Stages)
+		}
+		if order < last {
+			return fmt.Errorf("provenance step %d (%v) comes after a later stage, list the steps in chain order", i+1, step.Stage)
+		}
+		last = order
+		if step.Date == "" {
+			continue
+		}
+		date, err := time.Parse(models.CertDateLayout, step.Date)
+		if err != nil {
+			return fmt.Errorf("wrong date %q in provenance step %d, use YYYY-MM-DD", step.Date, i+1)
+		}
+		if date.Before(lastDate) {
+			return fmt.Errorf("provenance step %d is dated %v, before the step it follows", i+1, step.Date)
+		}
+		lastDate = date
+	}
+	return nil
 }
 
 func (env *MaterialsEnv) AddMaterialHandler(w http.ResponseWriter, r *http.Request) {
@@ -25,8 +59,30 @@ func (env *MaterialsEnv) AddMaterialHandler(w http.ResponseWriter, r *http.Reque
 		}
 
 		materialData.Id = helpers.GenerateId("M-")
+		materialData.Version = 1
+
+		err = checkProvenance(materialData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		err = checkUnitCosts(materialData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		unknown, err := canonicalSupplier(r.Context(), env.Suppliers, &materialData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(unknown) > 0 {
+			writeUnknownReferences(w, unknownReferences{Error: "unknown supplier", Suppliers: unknown})
+			return
+		}
 
-		err = env.Materials.Add(materialData)
+		err = env.Materials.Add(r.Context(), materialData)
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusInternalServerError)
@@ -34,6 +90,7 @@ func (env *MaterialsEnv) AddMaterialHandler(w http.ResponseWriter, r *http.Reque
 		}
 
 		w.Header().Set("Content-Type", "application/json")
+		setETag(w, materialData.Version)
 		w.WriteHeader(http.StatusCreated)
 
 		err = json.NewEncoder(w).Encode(materialData)
@@ -59,14 +116,42 @@ func (env *MaterialsEnv) UpdateMaterialHandler(w http.ResponseWriter, r *http.Re
 			return
 		}
 
-		err = env.Materials.Update(materialData)
+		version, ok := ifMatch(w, r)
+		if !ok {
+			return
+		}
+		materialData.Version = version
+
+		err = checkProvenance(materialData)
 		if err != nil {
-			thisErr := fmt.Sprintf("%v", err)
-			http.Error(w, thisErr, http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		err = checkUnitCosts(materialData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
 			return
 		}
 
+		unknown, err := canonicalSupplier(r.Context(), env.Suppliers, &materialData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(unknown) > 0 {
+			writeUnknownReferences(w, unknownReferences{Error: "unknown supplier", Suppliers: unknown})
+			return
+		}
+
+		err = env.Materials.Update(r.Context(), materialData)
+		if err != nil {
+			updateError(w, err)
+			return
+		}
+		materialData.Version++
+
 		w.Header().Set("Content-Type", "application/json")
+		setETag(w, materialData.Version)
 		w.WriteHeader(http.StatusOK)
 
 		err = json.NewEncoder(w).Encode(materialData)
@@ -84,7 +169,13 @@ func (env *MaterialsEnv) UpdateMaterialHandler(w http.ResponseWriter, r *http.Re
 func (env *MaterialsEnv) GetAllMaterialsHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		materials, err := env.Materials.GetAll()
+		expand, err := parseExpand(r, "supplier")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		materials, err := env.Materials.GetAll(r.Context())
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusBadRequest)
@@ -94,7 +185,7 @@ func (env *MaterialsEnv) GetAllMaterialsHandler(w http.ResponseWriter, r *http.R
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 
-		err = json.NewEncoder(w).Encode(materials)
+		err = json.NewEncoder(w).Encode(expand.materials(materials))
 		if err != nil {
 			log.Println("Failed to encode response:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -115,7 +206,13 @@ func (env *MaterialsEnv) GetMaterialsBySupplierHandler(w http.ResponseWriter, r
 			return
 		}
 
-		materials, err := env.Materials.GetBySupplier(id)
+		expand, err := parseExpand(r, "supplier")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		materials, err := env.Materials.GetBySupplier(r.Context(), id)
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusBadRequest)
@@ -125,7 +222,7 @@ func (env *MaterialsEnv) GetMaterialsBySupplierHandler(w http.ResponseWriter, r
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 
-		err = json.NewEncoder(w).Encode(materials)
+		err = json.NewEncoder(w).Encode(expand.materials(*materials))
 		if err != nil {
 			log.Println("Failed to encode response:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -140,14 +237,32 @@ func (env *MaterialsEnv) GetMaterialsBySupplierHandler(w http.ResponseWriter, r
 func (env *MaterialsEnv) GetOneMaterialHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		// /find-material?id=my_id
+		// /find-material?id=my_id[&at=2026-01-01T00:00:00Z]
 		id := r.URL.Query().Get("id")
 		if len(id) < 20 || len(id) > 25 {
 			http.Error(w, "Wrong ID format", http.StatusBadRequest)
 			return
 		}
 
-		material, err := env.Materials.GetOne(id)
+		expand, err := parseExpand(r, "supplier")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		at, err := parseAt(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		var material *models.Material
+		if at.IsZero() {
+			material, err = env.Materials.GetOne(r.Context(), id)
+		} else {
+			material = &models.Material{}
+			err = models.RecordAt(r.Context(), env.Audit, models.EntityMaterial, id, at, material)
+		}
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusBadRequest)
@@ -155,9 +270,12 @@ func (env *MaterialsEnv) GetOneMaterialHandler(w http.ResponseWriter, r *http.Re
 		}
 
 		w.Header().Set("Content-Type", "application/json")
+		if at.IsZero() {
+			setETag(w, material.Version)
+		}
 		w.WriteHeader(http.StatusOK)
 
-		err = json.NewEncoder(w).Encode(material)
+		err = json.NewEncoder(w).Encode(expand.material(*material, ""))
 		if err != nil {
 			log.Println("Failed to encode response:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -171,24 +289,143 @@ func (env *MaterialsEnv) GetOneMaterialHandler(w http.ResponseWriter, r *http.Re
 func (env *MaterialsEnv) DeleteOneMaterialHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodDelete:
-		// /delete-material?id=my_id
+		// /delete-material?id=my_id[&cascade=true|&reassign=other_id]
 		id := r.URL.Query().Get("id")
 		if len(id) < 20 || len(id) > 25 {
 			http.Error(w, "Wrong ID format", http.StatusBadRequest)
 			return
 		}
 
-		err := env.Materials.DeleteOne(id)
+		cascade, reassign, err := deleteMode(r)
 		if err != nil {
-			thisErr := fmt.Sprintf("%v", err)
-			http.Error(w, thisErr, http.StatusBadRequest)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		_, err = env.Materials.GetOne(r.Context(), id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		dependents, err := productsByMaterial(r.Context(), env.Products, id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		var productIDs []string
+		for _, product := range dependents {
+			productIDs = appendUnique(productIDs, product.Id)
+		}
+		lots, err := env.Lots.GetByMaterial(r.Context(), id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		subjects := []string{id}
+		if cascade {
+			subjects = append(append(subjects, productIDs...), lotIDs(lots)...)
+		}
+		certIDs, err := certsAbout(r.Context(), env.Certs, subjects)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := deleteResult{Message: "Material deleted"}
+		switch {
+		case reassign != "":
+			if reassign == id {
+				http.Error(w, "Cannot reassign a material to itself", http.StatusBadRequest)
+				return
+			}
+			if len(certIDs) > 0 {
+				writeConflict(w, conflictResponse{
+					Error: fmt.Sprintf("material %v has %d certifications, delete them first", id, len(certIDs)),
+					Certs: certIDs,
+				})
+				return
+			}
+			target, err := env.Materials.GetOne(r.Context(), reassign)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+				return
+			}
+			usedLotIDs, lotProductIDs, err := usedLots(r.Context(), env.Products, lots)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				return
+			}
+			if len(usedLotIDs) > 0 {
+				writeConflict(w, conflictResponse{
+					Error:    fmt.Sprintf("products were made from %d lots of material %v, they cannot be reassigned", len(usedLotIDs), id),
+					Products: lotProductIDs,
+					Lots:     usedLotIDs,
+				})
+				return
+			}
+			for _, product := range dependents {
+				if err := env.Products.Update(r.Context(), replaceMaterial(product, id, *target)); err != nil {
+					writePartialDelete(w, result, err)
+					return
+				}
+				result.ReassignedProducts = appendUnique(result.ReassignedProducts, product.Id)
+			}
+			for _, lot := range lots {
+				lot.MaterialID = target.Id
+				if err := env.Lots.Update(r.Context(), lot); err != nil {
+					writePartialDelete(w, result, err)
+					return
+				}
+				result.ReassignedLots = append(result.ReassignedLots, lot.Id)
+			}
+		case cascade:
+			result.DeletedCerts, err = deleteCerts(r.Context(), env.Certs, certIDs)
+			if err != nil {
+				writePartialDelete(w, result, err)
+				return
+			}
+			for _, productID := range productIDs {
+				if err := env.Products.DeleteOne(r.Context(), productID); err != nil {
+					writePartialDelete(w, result, err)
+					return
+				}
+				result.DeletedProducts = append(result.DeletedProducts, productID)
+			}
+			result.DeletedLots, err = deleteLotsOf(r.Context(), env.Lots, []string{id})
+			if err != nil {
+				writePartialDelete(w, result, err)
+				return
+			}
+		case len(productIDs) > 0 || len(lots) > 0 || len(certIDs) > 0:
+			writeConflict(w, conflictResponse{
+				Error: fmt.Sprintf("material %v is still used by %d products, %d lots and %d certifications",
+					id, len(productIDs), len(lots), len(certIDs)),
+				Products: productIDs,
+				Lots:     lotIDs(lots),
+				Certs:    certIDs,
+			})
+			return
+		}
+
+		err = env.Materials.DeleteOne(r.Context(), id)
+		if err != nil && result.changed() {
+			writePartialDelete(w, result, err)
+			return
+		}
+		if err != nil {
+			deleteError(w, err)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 
-		err = json.NewEncoder(w).Encode("Material deleted")
+		if cascade || reassign != "" {
+			err = json.NewEncoder(w).Encode(result)
+		} else {
+			err = json.NewEncoder(w).Encode("Material deleted")
+		}
 		if err != nil {
 			log.Println("Failed to encode response:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
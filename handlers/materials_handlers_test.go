@@ -0,0 +1,205 @@
+package handlers_test
+
+import (
+	"marvinhagler/models"
+	"net/http"
+	"testing"
+)
+
+// catalog is a supplier, one of its materials and a product made with it
+type catalog struct {
+	prefix, supplier, material, product string
+}
+
+func (s *testServer) catalog(prefix string) catalog {
+	s.t.Helper()
+	c := catalog{prefix: prefix}
+	c.supplier = s.add(prefix+"/suppliers/add", map[string]string{"name": "Gold Co", "country": "IT"})
+	c.material = s.add(prefix+"/materials/add", map[string]interface{}{"name": "18k gold", "supplier": map[string]string{"id": c.supplier}})
+	c.product = s.add(prefix+"/products/add", map[string]interface{}{"name": "Ring", "price": 120, "materials": []map[string]string{{"id": c.material}}})
+	return c
+}
+
+type conflict struct {
+	Error     string   `json:"error"`
+	Materials []string `json:"materials"`
+	Products  []string `json:"products"`
+	Lots      []string `json:"lots"`
+	Certs     []string `json:"certs"`
+}
+
+type deleteResult struct {
+	DeletedMaterials   []string `json:"deleted_materials"`
+	DeletedProducts    []string `json:"deleted_products"`
+	DeletedLots        []string `json:"deleted_lots"`
+	DeletedCerts       []string `json:"deleted_certs"`
+	ReassignedProducts []string `json:"reassigned_products"`
+	ReassignedLots     []string `json:"reassigned_lots"`
+}
+
+func TestMaterialNotFound(t *testing.T) {
+	s := newTestServer(t)
+	prefix := s.company("acme")
+
+	w := s.do(http.MethodGet, prefix+"/materials/find-material?id="+missingID, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = s.do(http.MethodDelete, prefix+"/materials/delete-material?id="+missingID, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestAddMaterialUnknownSupplier(t *testing.T) {
+	s := newTestServer(t)
+	prefix := s.company("acme")
+
+	w := s.do(http.MethodPost, prefix+"/materials/add", map[string]interface{}{"name": "18k gold", "supplier": map[string]string{"id": missingID}})
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+	var unknown struct {
+		Suppliers []string `json:"suppliers"`
+	}
+	decode(t, w, &unknown)
+	if len(unknown.Suppliers) != 1 || unknown.Suppliers[0] != missingID {
+		t.Errorf("got unknown suppliers %v, want [%v]", unknown.Suppliers, missingID)
+	}
+}
+
+func TestDeleteMaterialInUse(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	lot := s.lot(c.prefix, c.material)
+
+	w := s.do(http.MethodDelete, c.prefix+"/materials/delete-material?id="+c.material, nil)
+	expectStatus(t, w, http.StatusConflict)
+	var body conflict
+	decode(t, w, &body)
+	if len(body.Products) != 1 || body.Products[0] != c.product {
+		t.Errorf("got products %v, want [%v]", body.Products, c.product)
+	}
+	if len(body.Lots) != 1 || body.Lots[0] != lot {
+		t.Errorf("got lots %v, want [%v]", body.Lots, lot)
+	}
+
+	w = s.do(http.MethodGet, c.prefix+"/materials/find-material?id="+c.material, nil)
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestDeleteMaterialCascade(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	lot := s.lot(c.prefix, c.material)
+
+	w := s.do(http.MethodDelete, c.prefix+"/materials/delete-material?id="+c.material+"&cascade=true", nil)
+	expectStatus(t, w, http.StatusOK)
+	var result deleteResult
+	decode(t, w, &result)
+	if len(result.DeletedProducts) != 1 || result.DeletedProducts[0] != c.product {
+		t.Errorf("got %+v, want product %v deleted", result, c.product)
+	}
+	if len(result.DeletedLots) != 1 || result.DeletedLots[0] != lot {
+		t.Errorf("got %+v, want lot %v deleted", result, lot)
+	}
+	w = s.do(http.MethodGet, c.prefix+"/lots/find-lot?id="+lot, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = s.do(http.MethodGet, c.prefix+"/materials/find-material?id="+c.material, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = s.do(http.MethodGet, c.prefix+"/products/find-product?id="+c.product, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestReassignMaterial(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	silver := s.add(c.prefix+"/materials/add", map[string]interface{}{"name": "Silver", "supplier": map[string]string{"id": c.supplier}})
+
+	w := s.do(http.MethodDelete, c.prefix+"/materials/delete-material?id="+c.material+"&reassign="+c.material, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = s.do(http.MethodDelete, c.prefix+"/materials/delete-material?id="+c.material+"&reassign="+silver, nil)
+	expectStatus(t, w, http.StatusOK)
+	var result deleteResult
+	decode(t, w, &result)
+	if len(result.ReassignedProducts) != 1 || result.ReassignedProducts[0] != c.product {
+		t.Errorf("got %+v, want product %v reassigned", result, c.product)
+	}
+
+	var product struct {
+		Materials []struct {
+			Id string `json:"id"`
+		} `json:"materials"`
+	}
+	w = s.do(http.MethodGet, c.prefix+"/products/find-product?id="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &product)
+	if len(product.Materials) != 1 || product.Materials[0].Id != silver {
+		t.Errorf("got materials %+v, want only %v", product.Materials, silver)
+	}
+}
+
+func TestReassignMaterialMergesBOM(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	silver := s.add(c.prefix+"/materials/add", map[string]interface{}{"name": "Silver", "supplier": map[string]string{"id": c.supplier}})
+	product := s.add(c.prefix+"/products/add", map[string]interface{}{
+		"name": "Two tone ring",
+		"bom": []map[string]interface{}{
+			{"materialId": c.material, "quantity": 3, "unit": "g"},
+			{"materialId": silver, "quantity": 2, "unit": "g", "wastePct": 10},
+		},
+	})
+	lot := s.lot(c.prefix, c.material)
+
+	w := s.do(http.MethodDelete, c.prefix+"/materials/delete-material?id="+c.material+"&reassign="+silver, nil)
+	expectStatus(t, w, http.StatusOK)
+	var result deleteResult
+	decode(t, w, &result)
+	if len(result.ReassignedProducts) != 2 || len(result.ReassignedLots) != 1 || result.ReassignedLots[0] != lot {
+		t.Errorf("got %+v, want two products and lot %v reassigned", result, lot)
+	}
+
+	var moved models.Lot
+	w = s.do(http.MethodGet, c.prefix+"/lots/find-lot?id="+lot, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &moved)
+	if moved.MaterialID != silver {
+		t.Errorf("lot still of material %v, want %v", moved.MaterialID, silver)
+	}
+
+	// both lines are silver now and merge into one with the same gross quantity
+	var merged models.Product
+	w = s.do(http.MethodGet, c.prefix+"/products/find-product?id="+product, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &merged)
+	if len(merged.BOM) != 1 {
+		t.Fatalf("got bom %+v, want one line", merged.BOM)
+	}
+	line := merged.BOM[0]
+	if line.MaterialID != silver || line.Quantity != 5 || line.WastePct != 4 {
+		t.Errorf("got %+v, want 5 g of %v with 4%% waste", line, silver)
+	}
+}
+
+func TestReassignMaterialWithUsedLots(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	silver := s.add(c.prefix+"/materials/add", map[string]interface{}{"name": "Silver", "supplier": map[string]string{"id": c.supplier}})
+	lot := s.lot(c.prefix, c.material)
+	product := s.add(c.prefix+"/products/add", map[string]interface{}{
+		"name": "Band", "materials": []map[string]string{{"id": c.material}}, "lots": []string{lot},
+	})
+
+	w := s.do(http.MethodDelete, c.prefix+"/materials/delete-material?id="+c.material+"&reassign="+silver, nil)
+	expectStatus(t, w, http.StatusConflict)
+	var body conflict
+	decode(t, w, &body)
+	if len(body.Lots) != 1 || body.Lots[0] != lot || len(body.Products) != 1 || body.Products[0] != product {
+		t.Errorf("got %+v, want lot %v used by %v", body, lot, product)
+	}
+
+	var kept models.Lot
+	w = s.do(http.MethodGet, c.prefix+"/lots/find-lot?id="+lot, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &kept)
+	if kept.MaterialID != c.material {
+		t.Errorf("lot moved to %v by a refused reassign", kept.MaterialID)
+	}
+}
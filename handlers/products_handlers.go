@@ -10,7 +10,11 @@ import (
 )
 
 type ProductsEnv struct {
-	Products *models.ProductModel
+	Products  models.ProductRepository
+	Materials models.MaterialRepository
+	Lots      models.LotRepository
+	Certs     models.CertRepository
+	Audit     models.AuditRepository
 }
 
 func (env *ProductsEnv) AddProductHandler(w http.ResponseWriter, r *http.Request) {
@@ -25,8 +29,41 @@ func (env *ProductsEnv) AddProductHandler(w http.ResponseWriter, r *http.Request
 		}
 
 		productData.Id = helpers.GenerateId("P-")
+		productData.Version = 1
 
-		err = env.Products.Add(productData)
+		err = checkBOM(productData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		err = checkCostLines(productData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		bomMaterials(&productData)
+
+		unknown, err := canonicalMaterials(r.Context(), env.Materials, &productData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(unknown) > 0 {
+			writeUnknownReferences(w, unknownReferences{Error: "unknown materials", Materials: unknown})
+			return
+		}
+
+		lots, err := productLots(r.Context(), env.Lots, productData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if lots != nil {
+			writeUnknownReferences(w, *lots)
+			return
+		}
+
+		err = env.Products.Add(r.Context(), productData)
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusInternalServerError)
@@ -34,6 +71,7 @@ func (env *ProductsEnv) AddProductHandler(w http.ResponseWriter, r *http.Request
 		}
 
 		w.Header().Set("Content-Type", "application/json")
+		setETag(w, productData.Version)
 		w.WriteHeader(http.StatusCreated)
 
 		err = json.NewEncoder(w).Encode(productData)
@@ -59,14 +97,53 @@ func (env *ProductsEnv) UpdateProductHandler(w http.ResponseWriter, r *http.Requ
 			return
 		}
 
-		err = env.Products.Update(productData)
+		version, ok := ifMatch(w, r)
+		if !ok {
+			return
+		}
+		productData.Version = version
+
+		err = checkBOM(productData)
 		if err != nil {
-			thisErr := fmt.Sprintf("%v", err)
-			http.Error(w, thisErr, http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		err = checkCostLines(productData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		bomMaterials(&productData)
+
+		unknown, err := canonicalMaterials(r.Context(), env.Materials, &productData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(unknown) > 0 {
+			writeUnknownReferences(w, unknownReferences{Error: "unknown materials", Materials: unknown})
 			return
 		}
 
+		lots, err := productLots(r.Context(), env.Lots, productData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if lots != nil {
+			writeUnknownReferences(w, *lots)
+			return
+		}
+
+		err = env.Products.Update(r.Context(), productData)
+		if err != nil {
+			updateError(w, err)
+			return
+		}
+		productData.Version++
+
 		w.Header().Set("Content-Type", "application/json")
+		setETag(w, productData.Version)
 		w.WriteHeader(http.StatusOK)
 
 		err = json.NewEncoder(w).Encode(productData)
@@ -84,7 +161,13 @@ func (env *ProductsEnv) UpdateProductHandler(w http.ResponseWriter, r *http.Requ
 func (env *ProductsEnv) GetAllProductsHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		products, err := env.Products.GetAll()
+		expand, err := parseExpand(r, "materials", "materials.supplier")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		products, err := env.Products.GetAll(r.Context())
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusBadRequest)
@@ -94,7 +177,7 @@ func (env *ProductsEnv) GetAllProductsHandler(w http.ResponseWriter, r *http.Req
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 
-		err = json.NewEncoder(w).Encode(products)
+		err = json.NewEncoder(w).Encode(expand.products(products))
 		if err != nil {
 			log.Println("Failed to encode response:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -108,14 +191,32 @@ func (env *ProductsEnv) GetAllProductsHandler(w http.ResponseWriter, r *http.Req
 func (env *ProductsEnv) GetOneProductHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		// /find-product?id=my_id
+		// /find-product?id=my_id[&at=2026-01-01T00:00:00Z]
 		id := r.URL.Query().Get("id")
 		if len(id) < 20 || len(id) > 25 {
 			http.Error(w, "Wrong ID format", http.StatusBadRequest)
 			return
 		}
 
-		product, err := env.Products.GetOne(id)
+		expand, err := parseExpand(r, "materials", "materials.supplier")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		at, err := parseAt(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		var product *models.Product
+		if at.IsZero() {
+			product, err = env.Products.GetOne(r.Context(), id)
+		} else {
+			product = &models.Product{}
+			err = models.RecordAt(r.Context(), env.Audit, models.EntityProduct, id, at, product)
+		}
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusBadRequest)
@@ -123,9 +224,12 @@ func (env *ProductsEnv) GetOneProductHandler(w http.ResponseWriter, r *http.Requ
 		}
 
 		w.Header().Set("Content-Type", "application/json")
+		if at.IsZero() {
+			setETag(w, product.Version)
+		}
 		w.WriteHeader(http.StatusOK)
 
-		err = json.NewEncoder(w).Encode(product)
+		err = json.NewEncoder(w).Encode(expand.product(*product))
 		if err != nil {
 			log.Println("Failed to encode response:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -146,7 +250,13 @@ func (env *ProductsEnv) GetProductsByMaterialHandler(w http.ResponseWriter, r *h
 			return
 		}
 
-		products, err := env.Products.GetByMaterial(id)
+		expand, err := parseExpand(r, "materials", "materials.supplier")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		products, err := env.Products.GetByMaterial(r.Context(), id)
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusBadRequest)
@@ -156,7 +266,7 @@ func (env *ProductsEnv) GetProductsByMaterialHandler(w http.ResponseWriter, r *h
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 
-		err = json.NewEncoder(w).Encode(products)
+		err = json.NewEncoder(w).Encode(expand.products(*products))
 		if err != nil {
 			log.Println("Failed to encode response:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -171,14 +281,38 @@ func (env *ProductsEnv) GetProductsByMaterialHandler(w http.ResponseWriter, r *h
 func (env *ProductsEnv) DeleteOneProductHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodDelete:
-		// /delete-product?id=my_id
+		// /delete-product?id=my_id[&cascade=true]
 		id := r.URL.Query().Get("id")
 		if len(id) < 20 || len(id) > 25 {
 			http.Error(w, "Wrong ID format", http.StatusBadRequest)
 			return
 		}
+		cascade := r.URL.Query().Get("cascade") == "true"
+
+		certIDs, err := certsAbout(r.Context(), env.Certs, []string{id})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(certIDs) > 0 && !cascade {
+			writeConflict(w, conflictResponse{
+				Error: fmt.Sprintf("product %v has %d certifications", id, len(certIDs)),
+				Certs: certIDs,
+			})
+			return
+		}
+		result := deleteResult{Message: "Product deleted"}
+		result.DeletedCerts, err = deleteCerts(r.Context(), env.Certs, certIDs)
+		if err != nil {
+			writePartialDelete(w, result, err)
+			return
+		}
 
-		err := env.Products.DeleteOne(id)
+		err = env.Products.DeleteOne(r.Context(), id)
+		if err != nil && result.changed() {
+			writePartialDelete(w, result, err)
+			return
+		}
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusBadRequest)
@@ -188,7 +322,11 @@ func (env *ProductsEnv) DeleteOneProductHandler(w http.ResponseWriter, r *http.R
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 
-		err = json.NewEncoder(w).Encode("Product deleted")
+		if cascade {
+			err = json.NewEncoder(w).Encode(result)
+		} else {
+			err = json.NewEncoder(w).Encode("Product deleted")
+		}
 		if err != nil {
 			log.Println("Failed to encode response:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -0,0 +1,144 @@
+package handlers_test
+
+import (
+	"marvinhagler/models"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestProductNotFound(t *testing.T) {
+	s := newTestServer(t)
+	prefix := s.company("acme")
+
+	w := s.do(http.MethodGet, prefix+"/products/find-product?id="+missingID, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = s.do(http.MethodDelete, prefix+"/products/delete-product?id="+missingID, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = s.do(http.MethodGet, prefix+"/products/find-product?id=short", nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestAddProduct(t *testing.T) {
+	s := newTestServer(t)
+	prefix := s.company("acme")
+
+	w := s.do(http.MethodPost, prefix+"/products/add", map[string]interface{}{"name": "Ring", "price": 120})
+	expectStatus(t, w, http.StatusCreated)
+	var added models.Product
+	decode(t, w, &added)
+
+	w = s.do(http.MethodGet, prefix+"/products/find-product?id="+added.Id, nil)
+	expectStatus(t, w, http.StatusOK)
+	var found models.Product
+	decode(t, w, &found)
+	if found.Name != "Ring" || found.Price != 120 {
+		t.Errorf("got %+v, want the Ring at 120", found)
+	}
+
+	w = s.do(http.MethodDelete, prefix+"/products/delete-product?id="+added.Id, nil)
+	expectStatus(t, w, http.StatusOK)
+	w = s.do(http.MethodGet, prefix+"/products/find-product?id="+added.Id, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestAddProductUnknownMaterials(t *testing.T) {
+	s := newTestServer(t)
+	prefix := s.company("acme")
+
+	w := s.do(http.MethodPost, prefix+"/products/add", map[string]interface{}{
+		"name": "Ring", "materials": []map[string]string{{"id": missingID}},
+	})
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+	var unknown struct {
+		Materials []string `json:"materials"`
+	}
+	decode(t, w, &unknown)
+	if len(unknown.Materials) != 1 || unknown.Materials[0] != missingID {
+		t.Errorf("got unknown materials %v, want [%v]", unknown.Materials, missingID)
+	}
+
+	w = s.do(http.MethodGet, prefix+"/products/all", nil)
+	expectStatus(t, w, http.StatusOK)
+	var products []models.Product
+	decode(t, w, &products)
+	if len(products) != 0 {
+		t.Errorf("product with unknown materials stored: %+v", products)
+	}
+}
+
+func TestProductAt(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	before := time.Now().UTC()
+	time.Sleep(2 * time.Millisecond)
+
+	w := s.do(http.MethodPut, c.prefix+"/products/update", map[string]interface{}{
+		"id": c.product, "name": "Gold ring", "price": 120, "materials": []map[string]string{{"id": c.material}},
+	}, ifMatch(1)...)
+	expectStatus(t, w, http.StatusOK)
+
+	var product models.Product
+	w = s.do(http.MethodGet, c.prefix+"/products/find-product?id="+c.product+"&at="+url.QueryEscape(before.Format(time.RFC3339Nano)), nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &product)
+	if product.Name != "Ring" {
+		t.Errorf("got %v at %v, want Ring", product.Name, before)
+	}
+	if etag := w.Header().Get("ETag"); etag != "" {
+		t.Errorf("read of a past revision sent ETag %v", etag)
+	}
+
+	production := s.key(c.prefix, models.RoleProduction)
+	w = s.doWith(production, http.MethodGet, c.prefix+"/products/find-product?id="+c.product+"&at="+url.QueryEscape(before.Format(time.RFC3339Nano)), nil)
+	expectStatus(t, w, http.StatusForbidden)
+	w = s.doWith(production, http.MethodGet, c.prefix+"/products/find-product?id="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+
+	w = s.do(http.MethodGet, c.prefix+"/products/find-product?id="+c.product+"&at=2000-01-01T00:00:00Z", nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = s.do(http.MethodGet, c.prefix+"/products/find-product?id="+c.product+"&at=yesterday", nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	var revisions []models.Revision
+	w = s.do(http.MethodGet, c.prefix+"/history?id="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &revisions)
+	if len(revisions) != 2 {
+		t.Errorf("got %d revisions, want 2: %+v", len(revisions), revisions)
+	}
+}
+
+func TestUpdateProductVersions(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	update := map[string]interface{}{"id": c.product, "name": "Gold ring", "materials": []map[string]string{{"id": c.material}}}
+
+	w := s.do(http.MethodGet, c.prefix+"/products/find-product?id="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+	if etag := w.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("got ETag %v, want \"1\"", etag)
+	}
+
+	w = s.do(http.MethodPut, c.prefix+"/products/update", update)
+	expectStatus(t, w, http.StatusPreconditionRequired)
+
+	w = s.do(http.MethodPut, c.prefix+"/products/update", update, ifMatch(1)...)
+	expectStatus(t, w, http.StatusOK)
+	if etag := w.Header().Get("ETag"); etag != `"2"` {
+		t.Errorf("got ETag %v after the update, want \"2\"", etag)
+	}
+
+	// a second client still holding version 1
+	w = s.do(http.MethodPut, c.prefix+"/products/update", update, ifMatch(1)...)
+	expectStatus(t, w, http.StatusPreconditionFailed)
+
+	var product models.Product
+	w = s.do(http.MethodGet, c.prefix+"/products/find-product?id="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &product)
+	if product.Name != "Gold ring" || product.Version != 2 {
+		t.Errorf("got %v version %d, want Gold ring version 2", product.Name, product.Version)
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"marvinhagler/models"
+	"net/http"
+	"strings"
+)
+
+// materialChain is the chain of custody of one material of a product, ending
+// with its supplier, and the lots of it the product was made from
+type materialChain struct {
+	MaterialID string               `json:"materialId"`
+	Name       string               `json:"name"`
+	Steps      []models.CustodyStep `json:"steps"`
+	Lots       []models.Lot         `json:"lots"`
+}
+
+type productChain struct {
+	ProductID string          `json:"productId"`
+	Name      string          `json:"name"`
+	Materials []materialChain `json:"materials"`
+}
+
+// chain renders the chain of custody of material, the supplier closes it
+// when no step names one
+func chain(material models.Material) []models.CustodyStep {
+	steps := append([]models.CustodyStep{}, material.Provenance...)
+	for _, step := range steps {
+		if step.Stage == models.StageSupplier {
+			return steps
+		}
+	}
+	if material.Supplier.Id == "" {
+		return steps
+	}
+
+	var location []string
+	for _, part := range []string{material.Supplier.City, material.Supplier.Country} {
+		if part != "" {
+			location = append(location, part)
+		}
+	}
+	return append(steps, models.CustodyStep{
+		Stage:    models.StageSupplier,
+		Name:     material.Supplier.Name,
+		Location: strings.Join(location, ", "),
+	})
+}
+
+// productChain walks every material of product
+func (env *ProductsEnv) productChain(ctx context.Context, product models.Product) (productChain, error) {
+	result := productChain{ProductID: product.Id, Name: product.Name, Materials: []materialChain{}}
+
+	lots := make([]models.Lot, 0, len(product.Lots))
+	for _, id := range product.Lots {
+		lot, err := env.Lots.GetOne(ctx, id)
+		if err != nil {
+			return result, err
+		}
+		lots = append(lots, *lot)
+	}
+
+	for _, material := range product.Materials {
+		materialChain := materialChain{MaterialID: material.Id, Name: material.Name, Steps: chain(material), Lots: []models.Lot{}}
+		for _, lot := range lots {
+			if lot.MaterialID == material.Id {
+				materialChain.Lots = append(materialChain.Lots, lot)
+			}
+		}
+		result.Materials = append(result.Materials, materialChain)
+	}
+	return result, nil
+}
+
+func (env *ProductsEnv) GetProvenanceHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /products/provenance?id=my_id
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		product, err := env.Products.GetOne(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		result, err := env.productChain(r.Context(), *product)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(result)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,56 @@
+package handlers_test
+
+import (
+	"marvinhagler/models"
+	"net/http"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	gold := s.add(c.prefix+"/materials/add", map[string]interface{}{
+		"name": "Recycled gold", "supplier": map[string]string{"id": c.supplier},
+		"provenance": []map[string]string{
+			{"stage": models.StageExtraction, "name": "Mine", "location": "PE", "date": "2025-11-02"},
+			{"stage": models.StageRefiner, "name": "Refinery", "location": "CH", "date": "2025-12-01"},
+		},
+	})
+	product := s.add(c.prefix+"/products/add", map[string]interface{}{"name": "Band", "materials": []map[string]string{{"id": gold}}})
+
+	var chain struct {
+		Materials []struct {
+			MaterialID string               `json:"materialId"`
+			Steps      []models.CustodyStep `json:"steps"`
+		} `json:"materials"`
+	}
+	w := s.do(http.MethodGet, c.prefix+"/products/provenance?id="+product, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &chain)
+	if len(chain.Materials) != 1 || chain.Materials[0].MaterialID != gold {
+		t.Fatalf("got %+v, want the chain of %v", chain.Materials, gold)
+	}
+	var stages []string
+	for _, step := range chain.Materials[0].Steps {
+		stages = append(stages, step.Stage)
+	}
+	if len(stages) != 3 || stages[0] != models.StageExtraction || stages[1] != models.StageRefiner || stages[2] != models.StageSupplier {
+		t.Errorf("got stages %v, want extraction, refiner and the supplier closing the chain", stages)
+	}
+}
+
+func TestProvenanceOrder(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+
+	for _, steps := range [][]map[string]string{
+		{{"stage": models.StageRefiner, "date": "2025-12-01"}, {"stage": models.StageExtraction, "date": "2025-12-02"}},
+		{{"stage": models.StageExtraction, "date": "2025-12-01"}, {"stage": models.StageRefiner, "date": "2025-11-01"}},
+		{{"stage": "smelter", "date": "2025-12-01"}},
+	} {
+		w := s.do(http.MethodPost, c.prefix+"/materials/add", map[string]interface{}{
+			"name": "Gold", "supplier": map[string]string{"id": c.supplier}, "provenance": steps,
+		})
+		expectStatus(t, w, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"marvinhagler/models"
+	"net/http"
+)
+
+// Products and materials sent by clients only need the ID of what they
+// reference. Before storing them, every referenced material and supplier is
+// looked up and replaced with the stored record, unknown IDs are rejected.
+
+type unknownReferences struct {
+	Error     string   `json:"error"`
+	Materials []string `json:"materials,omitempty"`
+	Suppliers []string `json:"suppliers,omitempty"`
+	Products  []string `json:"products,omitempty"`
+	Lots      []string `json:"lots,omitempty"`
+}
+
+// canonicalMaterials replaces the materials of product with the stored ones
+// and returns the IDs that do not exist
+func canonicalMaterials(ctx context.Context, materials models.MaterialRepository, product *models.Product) ([]string, error) {
+	var unknown []string
+	for i, material := range product.Materials {
+		stored, err := materials.GetOne(ctx, material.Id)
+		if errors.Is(err, models.ErrNotFound) {
+			unknown = appendUnique(unknown, material.Id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		product.Materials[i] = *stored
+	}
+	return unknown, nil
+}
+
+// canonicalSupplier replaces the supplier of material with the stored one and
+// returns its ID if it does not exist, a material may have no supplier
+func canonicalSupplier(ctx context.Context, suppliers models.SupplierRepository, material *models.Material) ([]string, error) {
+	if material.Supplier.Id == "" {
+		material.Supplier = models.Supplier{}
+		return nil, nil
+	}
+	stored, err := suppliers.GetOne(ctx, material.Supplier.Id)
+	if errors.Is(err, models.ErrNotFound) {
+		return []string{material.Supplier.Id}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	material.Supplier = *stored
+	return nil, nil
+}
+
+// productLots checks the lots of product exist and are lots of its materials,
+// it must run after canonicalMaterials
+func productLots(ctx context.Context, lots models.LotRepository, product models.Product) (*unknownReferences, error) {
+	made := map[string]bool{}
+	for _, material := range product.Materials {
+		made[material.Id] = true
+	}
+
+	var unknown, foreign []string
+	for _, id := range product.Lots {
+		lot, err := lots.GetOne(ctx, id)
+		if errors.Is(err, models.ErrNotFound) {
+			unknown = appendUnique(unknown, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !made[lot.MaterialID] {
+			foreign = appendUnique(foreign, id)
+		}
+	}
+	if len(unknown) > 0 {
+		return &unknownReferences{Error: "unknown lots", Lots: unknown}, nil
+	}
+	if len(foreign) > 0 {
+		return &unknownReferences{Error: "lots of materials the product is not made of", Lots: foreign}, nil
+	}
+	return nil, nil
+}
+
+// lotReferences looks up the material and supplier of lot, which defaults to
+// the supplier of the material, and returns what does not exist
+func lotReferences(ctx context.Context, materials models.MaterialRepository, suppliers models.SupplierRepository, lot *models.Lot) (*unknownReferences, error) {
+	material, err := materials.GetOne(ctx, lot.MaterialID)
+	if errors.Is(err, models.ErrNotFound) {
+		return &unknownReferences{Error: "unknown material", Materials: []string{lot.MaterialID}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if lot.SupplierID == "" {
+		lot.SupplierID = material.Supplier.Id
+		return nil, nil
+	}
+	_, err = suppliers.GetOne(ctx, lot.SupplierID)
+	if errors.Is(err, models.ErrNotFound) {
+		return &unknownReferences{Error: "unknown supplier", Suppliers: []string{lot.SupplierID}}, nil
+	}
+	return nil, err
+}
+
+// certSubjectExists looks up the subject of a certification, which may have none
+func certSubjectExists(ctx context.Context, suppliers models.SupplierRepository, materials models.MaterialRepository, products models.ProductRepository,
+	lots models.LotRepository, subject models.CertSubject) (bool, error) {
+	var err error
+	switch subject.Type {
+	case "":
+		if subject.Id != "" {
+			return false, fmt.Errorf("subject %v has no type", subject.Id)
+		}
+		return true, nil
+	case models.SubjectSupplier:
+		_, err = suppliers.GetOne(ctx, subject.Id)
+	case models.SubjectMaterial:
+		_, err = materials.GetOne(ctx, subject.Id)
+	case models.SubjectProduct:
+		_, err = products.GetOne(ctx, subject.Id)
+	case models.SubjectLot:
+		_, err = lots.GetOne(ctx, subject.Id)
+	default:
+		return false, fmt.Errorf("unknown subject type %q, use %v, %v, %v or %v", subject.Type,
+			models.SubjectSupplier, models.SubjectMaterial, models.SubjectProduct, models.SubjectLot)
+	}
+	if errors.Is(err, models.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// unknownSubject is the 422 body for a certification whose subject does not exist
+func unknownSubject(subject models.CertSubject) unknownReferences {
+	unknown := unknownReferences{Error: fmt.Sprintf("unknown %v", subject.Type)}
+	switch subject.Type {
+	case models.SubjectSupplier:
+		unknown.Suppliers = []string{subject.Id}
+	case models.SubjectMaterial:
+		unknown.Materials = []string{subject.Id}
+	case models.SubjectProduct:
+		unknown.Products = []string{subject.Id}
+	case models.SubjectLot:
+		unknown.Lots = []string{subject.Id}
+	}
+	return unknown
+}
+
+func writeUnknownReferences(w http.ResponseWriter, unknown unknownReferences) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+
+	err := json.NewEncoder(w).Encode(unknown)
+	if err != nil {
+		log.Println("Failed to encode response:", err)
+	}
+}
@@ -10,7 +10,12 @@ import (
 )
 
 type SuppliersEnv struct {
-	Suppliers *models.SupplierModel
+	Suppliers models.SupplierRepository
+	Materials models.MaterialRepository
+	Products  models.ProductRepository
+	Lots      models.LotRepository
+	Certs     models.CertRepository
+	Audit     models.AuditRepository
 }
 
 func (env *SuppliersEnv) AddSupplierHandler(w http.ResponseWriter, r *http.Request) {
@@ -25,8 +30,9 @@ func (env *SuppliersEnv) AddSupplierHandler(w http.ResponseWriter, r *http.Reque
 		}
 
 		supplierData.Id = helpers.GenerateId("S-")
+		supplierData.Version = 1
 
-		err = env.Suppliers.Add(supplierData)
+		err = env.Suppliers.Add(r.Context(), supplierData)
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusInternalServerError)
@@ -34,6 +40,7 @@ func (env *SuppliersEnv) AddSupplierHandler(w http.ResponseWriter, r *http.Reque
 		}
 
 		w.Header().Set("Content-Type", "application/json")
+		setETag(w, supplierData.Version)
 		w.WriteHeader(http.StatusCreated)
 
 		err = json.NewEncoder(w).Encode(supplierData)
@@ -59,14 +66,21 @@ func (env *SuppliersEnv) UpdateSupplierHandler(w http.ResponseWriter, r *http.Re
 			return
 		}
 
-		err = env.Suppliers.Update(supplierData)
+		version, ok := ifMatch(w, r)
+		if !ok {
+			return
+		}
+		supplierData.Version = version
+
+		err = env.Suppliers.Update(r.Context(), supplierData)
 		if err != nil {
-			thisErr := fmt.Sprintf("%v", err)
-			http.Error(w, thisErr, http.StatusInternalServerError)
+			updateError(w, err)
 			return
 		}
+		supplierData.Version++
 
 		w.Header().Set("Content-Type", "application/json")
+		setETag(w, supplierData.Version)
 		w.WriteHeader(http.StatusOK)
 
 		err = json.NewEncoder(w).Encode(supplierData)
@@ -84,7 +98,7 @@ func (env *SuppliersEnv) UpdateSupplierHandler(w http.ResponseWriter, r *http.Re
 func (env *SuppliersEnv) GetAllSuppliersHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		suppliers, err := env.Suppliers.GetAll()
+		suppliers, err := env.Suppliers.GetAll(r.Context())
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusBadRequest)
@@ -108,14 +122,26 @@ func (env *SuppliersEnv) GetAllSuppliersHandler(w http.ResponseWriter, r *http.R
 func (env *SuppliersEnv) GetOneSupplierHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		// /find-supplier?id=my_id
+		// /find-supplier?id=my_id[&at=2026-01-01T00:00:00Z]
 		id := r.URL.Query().Get("id")
 		if len(id) < 20 || len(id) > 25 {
 			http.Error(w, "Wrong ID format", http.StatusBadRequest)
 			return
 		}
 
-		supplier, err := env.Suppliers.GetOne(id)
+		at, err := parseAt(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		var supplier *models.Supplier
+		if at.IsZero() {
+			supplier, err = env.Suppliers.GetOne(r.Context(), id)
+		} else {
+			supplier = &models.Supplier{}
+			err = models.RecordAt(r.Context(), env.Audit, models.EntitySupplier, id, at, supplier)
+		}
 		if err != nil {
 			thisErr := fmt.Sprintf("%v", err)
 			http.Error(w, thisErr, http.StatusBadRequest)
@@ -123,6 +149,9 @@ func (env *SuppliersEnv) GetOneSupplierHandler(w http.ResponseWriter, r *http.Re
 		}
 
 		w.Header().Set("Content-Type", "application/json")
+		if at.IsZero() {
+			setETag(w, supplier.Version)
+		}
 		w.WriteHeader(http.StatusOK)
 
 		err = json.NewEncoder(w).Encode(supplier)
@@ -139,24 +168,130 @@ func (env *SuppliersEnv) GetOneSupplierHandler(w http.ResponseWriter, r *http.Re
 func (env *SuppliersEnv) DeleteOneSupplierHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodDelete:
-		// /delete-supplier?id=my_id
+		// /delete-supplier?id=my_id[&cascade=true|&reassign=other_id]
 		id := r.URL.Query().Get("id")
 		if len(id) < 20 || len(id) > 25 {
 			http.Error(w, "Wrong ID format", http.StatusBadRequest)
 			return
 		}
 
-		err := env.Suppliers.DeleteOne(id)
+		cascade, reassign, err := deleteMode(r)
 		if err != nil {
-			thisErr := fmt.Sprintf("%v", err)
-			http.Error(w, thisErr, http.StatusBadRequest)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		_, err = env.Suppliers.GetOne(r.Context(), id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		materialIDs, productIDs, err := supplierDependents(r.Context(), env.Materials, env.Products, id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		subjects := []string{id}
+		if cascade {
+			lots, err := lotsOf(r.Context(), env.Lots, materialIDs)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				return
+			}
+			subjects = append(append(append(subjects, materialIDs...), productIDs...), lotIDs(lots)...)
+		}
+		certIDs, err := certsAbout(r.Context(), env.Certs, subjects)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := deleteResult{Message: "Supplier deleted"}
+		switch {
+		case reassign != "":
+			if reassign == id {
+				http.Error(w, "Cannot reassign a supplier to itself", http.StatusBadRequest)
+				return
+			}
+			if len(certIDs) > 0 {
+				writeConflict(w, conflictResponse{
+					Error: fmt.Sprintf("supplier %v has %d certifications, delete them first", id, len(certIDs)),
+					Certs: certIDs,
+				})
+				return
+			}
+			target, err := env.Suppliers.GetOne(r.Context(), reassign)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+				return
+			}
+			dependents, err := materialsBySupplier(r.Context(), env.Materials, id)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				return
+			}
+			for _, material := range dependents {
+				material.Supplier = *target
+				if err := env.Materials.Update(r.Context(), material); err != nil {
+					writePartialDelete(w, result, err)
+					return
+				}
+				result.ReassignedMaterials = append(result.ReassignedMaterials, material.Id)
+			}
+		case cascade:
+			result.DeletedCerts, err = deleteCerts(r.Context(), env.Certs, certIDs)
+			if err != nil {
+				writePartialDelete(w, result, err)
+				return
+			}
+			for _, productID := range productIDs {
+				if err := env.Products.DeleteOne(r.Context(), productID); err != nil {
+					writePartialDelete(w, result, err)
+					return
+				}
+				result.DeletedProducts = append(result.DeletedProducts, productID)
+			}
+			result.DeletedLots, err = deleteLotsOf(r.Context(), env.Lots, materialIDs)
+			if err != nil {
+				writePartialDelete(w, result, err)
+				return
+			}
+			for _, materialID := range materialIDs {
+				if err := env.Materials.DeleteOne(r.Context(), materialID); err != nil {
+					writePartialDelete(w, result, err)
+					return
+				}
+				result.DeletedMaterials = append(result.DeletedMaterials, materialID)
+			}
+		case len(materialIDs) > 0 || len(certIDs) > 0:
+			writeConflict(w, conflictResponse{
+				Error:     fmt.Sprintf("supplier %v is still used by %d materials and %d certifications", id, len(materialIDs), len(certIDs)),
+				Materials: materialIDs,
+				Products:  productIDs,
+				Certs:     certIDs,
+			})
+			return
+		}
+
+		err = env.Suppliers.DeleteOne(r.Context(), id)
+		if err != nil && result.changed() {
+			writePartialDelete(w, result, err)
+			return
+		}
+		if err != nil {
+			deleteError(w, err)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 
-		err = json.NewEncoder(w).Encode("Supplier deleted")
+		if cascade || reassign != "" {
+			err = json.NewEncoder(w).Encode(result)
+		} else {
+			err = json.NewEncoder(w).Encode("Supplier deleted")
+		}
 		if err != nil {
 			log.Println("Failed to encode response:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"marvinhagler/handlers"
+	"marvinhagler/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSupplierNotFound(t *testing.T) {
+	s := newTestServer(t)
+	prefix := s.company("acme")
+
+	w := s.do(http.MethodGet, prefix+"/suppliers/find-supplier?id="+missingID, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = s.do(http.MethodDelete, prefix+"/suppliers/delete-supplier?id="+missingID, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestDeleteSupplierInUse(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+
+	w := s.do(http.MethodDelete, c.prefix+"/suppliers/delete-supplier?id="+c.supplier, nil)
+	expectStatus(t, w, http.StatusConflict)
+	var body conflict
+	decode(t, w, &body)
+	if len(body.Materials) != 1 || body.Materials[0] != c.material {
+		t.Errorf("got materials %v, want [%v]", body.Materials, c.material)
+	}
+
+	w = s.do(http.MethodGet, c.prefix+"/suppliers/find-supplier?id="+c.supplier, nil)
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestDeleteSupplierCascade(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	lot := s.lot(c.prefix, c.material)
+
+	w := s.do(http.MethodDelete, c.prefix+"/suppliers/delete-supplier?id="+c.supplier+"&cascade=true", nil)
+	expectStatus(t, w, http.StatusOK)
+	var result deleteResult
+	decode(t, w, &result)
+	if len(result.DeletedMaterials) != 1 || len(result.DeletedProducts) != 1 || len(result.DeletedLots) != 1 {
+		t.Errorf("got %+v, want one material, product and lot deleted", result)
+	}
+
+	for _, path := range []string{
+		c.prefix + "/suppliers/find-supplier?id=" + c.supplier,
+		c.prefix + "/materials/find-material?id=" + c.material,
+		c.prefix + "/products/find-product?id=" + c.product,
+		c.prefix + "/lots/find-lot?id=" + lot,
+	} {
+		w = s.do(http.MethodGet, path, nil)
+		expectStatus(t, w, http.StatusBadRequest)
+	}
+}
+
+// undeletableMaterials cannot delete materials
+type undeletableMaterials struct {
+	models.MaterialRepository
+}
+
+func (undeletableMaterials) DeleteOne(ctx context.Context, id string) error {
+	return errors.New("disk full")
+}
+
+func TestDeleteSupplierCascadeFailure(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	lot := s.lot(c.prefix, c.material)
+
+	env := &handlers.SuppliersEnv{Suppliers: s.repos.Suppliers, Materials: undeletableMaterials{s.repos.Materials}, Products: s.repos.Products, Lots: s.repos.Lots, Certs: s.repos.Certs, Audit: s.repos.Audit}
+	ctx := models.WithCompany(context.Background(), strings.TrimPrefix(c.prefix, "/companies/"))
+	r := httptest.NewRequest(http.MethodDelete, "/suppliers/delete-supplier?id="+c.supplier+"&cascade=true", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	env.DeleteOneSupplierHandler(w, r)
+	expectStatus(t, w, http.StatusInternalServerError)
+
+	var result deleteResult
+	decode(t, w, &result)
+	if len(result.DeletedProducts) != 1 || result.DeletedProducts[0] != c.product || len(result.DeletedLots) != 1 || result.DeletedLots[0] != lot {
+		t.Errorf("got %+v, want product %v and lot %v reported deleted", result, c.product, lot)
+	}
+	if len(result.DeletedMaterials) != 0 {
+		t.Errorf("got materials %v reported deleted", result.DeletedMaterials)
+	}
+
+	w = s.do(http.MethodGet, c.prefix+"/suppliers/find-supplier?id="+c.supplier, nil)
+	expectStatus(t, w, http.StatusOK)
+	w = s.do(http.MethodPost, c.prefix+"/trash/restore?id="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+}
@@ -0,0 +1,90 @@
+package handlers_test
+
+import (
+	"marvinhagler/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompaniesAreIsolated(t *testing.T) {
+	s := newTestServer(t)
+	a := s.catalog(s.company("acme"))
+	b := s.company("globex")
+	keyA := s.key(a.prefix, models.RoleAdmin)
+
+	w := s.doWith(keyA, http.MethodGet, b+"/products/all", nil)
+	expectStatus(t, w, http.StatusForbidden)
+	w = s.doWith(keyA, http.MethodPost, b+"/suppliers/add", map[string]string{"name": "Gold Co"})
+	expectStatus(t, w, http.StatusForbidden)
+
+	// the records of a company are not found under another one
+	w = s.do(http.MethodGet, b+"/products/find-product?id="+a.product, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = s.do(http.MethodDelete, b+"/suppliers/delete-supplier?id="+a.supplier, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = s.do(http.MethodGet, b+"/products/all", nil)
+	expectStatus(t, w, http.StatusOK)
+	var products []models.Product
+	decode(t, w, &products)
+	if len(products) != 0 {
+		t.Errorf("company %v lists products of another company: %+v", b, products)
+	}
+
+	// nor can they be referenced from it
+	w = s.do(http.MethodPost, b+"/materials/add", map[string]interface{}{"name": "18k gold", "supplier": map[string]string{"id": a.supplier}})
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+
+	w = s.doWith(keyA, http.MethodGet, a.prefix+"/products/find-product?id="+a.product, nil)
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestCompanyRequired(t *testing.T) {
+	s := newTestServer(t)
+
+	w := s.do(http.MethodGet, "/products/all", nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = s.do(http.MethodGet, "/companies/000000000000000000000000/products/all", nil)
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func TestKeys(t *testing.T) {
+	s := newTestServer(t)
+	prefix := s.company("acme")
+	key := s.key(prefix, models.RoleAdmin)
+
+	w := s.doWith("", http.MethodGet, prefix+"/products/all", nil)
+	expectStatus(t, w, http.StatusUnauthorized)
+	w = s.doWith("not-a-key", http.MethodGet, prefix+"/products/all", nil)
+	expectStatus(t, w, http.StatusUnauthorized)
+	w = s.doWith(key, http.MethodGet, prefix+"/products/all", nil)
+	expectStatus(t, w, http.StatusOK)
+
+	// a company key works without the prefix and cannot manage companies
+	w = s.doWith(key, http.MethodGet, "/products/all", nil)
+	expectStatus(t, w, http.StatusOK)
+	w = s.doWith(key, http.MethodPost, "/company/init", map[string]string{"name": "globex"})
+	expectStatus(t, w, http.StatusForbidden)
+}
+
+func TestRoles(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	auditor := s.key(c.prefix, models.RoleAuditor)
+	buyer := s.key(c.prefix, models.RoleBuyer)
+
+	w := s.doWith(auditor, http.MethodGet, c.prefix+"/products/find-product?id="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+	w = s.doWith(auditor, http.MethodPost, c.prefix+"/products/add", map[string]interface{}{"name": "Ring", "materials": []map[string]string{{"id": c.material}}})
+	expectStatus(t, w, http.StatusForbidden)
+	if !strings.Contains(w.Body.String(), "Missing permission") {
+		t.Errorf("got %q, want the missing permission", w.Body.String())
+	}
+
+	w = s.doWith(buyer, http.MethodPost, c.prefix+"/materials/add", map[string]interface{}{"name": "Silver", "supplier": map[string]string{"id": c.supplier}})
+	expectStatus(t, w, http.StatusCreated)
+	w = s.doWith(buyer, http.MethodDelete, c.prefix+"/products/delete-product?id="+c.product, nil)
+	expectStatus(t, w, http.StatusForbidden)
+	w = s.doWith(buyer, http.MethodPost, c.prefix+"/keys/create", map[string]string{"name": "mine", "role": string(models.RoleAdmin)})
+	expectStatus(t, w, http.StatusForbidden)
+}
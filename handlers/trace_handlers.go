@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"marvinhagler/models"
+	"net/http"
+)
+
+// Lots are traced forward, to the products made from them, and backward, from
+// a product to the lots it was made from and the suppliers that delivered them.
+
+type TraceEnv struct {
+	Lots      models.LotRepository
+	Products  models.ProductRepository
+	Materials models.MaterialRepository
+	Suppliers models.SupplierRepository
+}
+
+// tracedLot is a lot with its material and supplier, left out when deleted
+type tracedLot struct {
+	models.Lot
+	Material *models.Material `json:"material,omitempty"`
+	Supplier *models.Supplier `json:"supplier,omitempty"`
+}
+
+type forwardTrace struct {
+	Lot      tracedLot        `json:"lot"`
+	Products []models.Product `json:"products"`
+}
+
+type backwardTrace struct {
+	Product   models.Product    `json:"product"`
+	Lots      []tracedLot       `json:"lots"`
+	Suppliers []models.Supplier `json:"suppliers"`
+}
+
+// trace looks up the material and supplier of lot
+func (env *TraceEnv) trace(ctx context.Context, lot models.Lot) (tracedLot, error) {
+	traced := tracedLot{Lot: lot}
+
+	material, err := env.Materials.GetOne(ctx, lot.MaterialID)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return traced, err
+	}
+	traced.Material = material
+
+	if lot.SupplierID != "" {
+		supplier, err := env.Suppliers.GetOne(ctx, lot.SupplierID)
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			return traced, err
+		}
+		traced.Supplier = supplier
+	}
+	return traced, nil
+}
+
+func (env *TraceEnv) TraceForwardHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /trace/forward?lot_id=id
+		id := r.URL.Query().Get("lot_id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		lot, err := env.Lots.GetOne(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		traced, err := env.trace(r.Context(), *lot)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		products, err := env.Products.GetByLot(r.Context(), id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(forwardTrace{Lot: traced, Products: products})
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *TraceEnv) TraceBackwardHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /trace/backward?product_id=id
+		id := r.URL.Query().Get("product_id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		product, err := env.Products.GetOne(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		result := backwardTrace{Product: *product, Lots: []tracedLot{}, Suppliers: []models.Supplier{}}
+		seen := map[string]bool{}
+		for _, lotID := range product.Lots {
+			lot, err := env.Lots.GetOne(r.Context(), lotID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				return
+			}
+			traced, err := env.trace(r.Context(), *lot)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				return
+			}
+			result.Lots = append(result.Lots, traced)
+			if traced.Supplier != nil && !seen[traced.Supplier.Id] {
+				seen[traced.Supplier.Id] = true
+				result.Suppliers = append(result.Suppliers, *traced.Supplier)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(result)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"marvinhagler/models"
+	"net/http"
+)
+
+type TrashEnv struct {
+	Trash     models.TrashRepository
+	Products  models.ProductRepository
+	Materials models.MaterialRepository
+	Suppliers models.SupplierRepository
+	Lots      models.LotRepository
+	Certs     models.CertRepository
+}
+
+func (env *TrashEnv) GetTrashHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /trash[?type=product|material|supplier|lot|cert]
+		entityType := r.URL.Query().Get("type")
+		switch entityType {
+		case "", models.EntityProduct, models.EntityMaterial, models.EntitySupplier, models.EntityLot, models.EntityCert:
+		default:
+			http.Error(w, fmt.Sprintf("Unknown type %q", entityType), http.StatusBadRequest)
+			return
+		}
+
+		items, err := env.Trash.GetAll(r.Context())
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		if entityType != "" {
+			filtered := []models.TrashItem{}
+			for _, item := range items {
+				if item.EntityType == entityType {
+					filtered = append(filtered, item)
+				}
+			}
+			items = filtered
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(items)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *TrashEnv) RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		// /trash/restore?id=my_id
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		item, err := env.Trash.GetOne(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		restored, unknown, err := env.restore(r.Context(), *item)
+		if errors.Is(err, models.ErrDuplicate) {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, models.ErrNotFound) {
+			// restored or purged by someone else in the meantime
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		if unknown != nil {
+			writeUnknownReferences(w, *unknown)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(restored)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// restore adds the record of item back with its ID and takes it out of the
+// trash. The item leaves the trash first and goes back when the add fails, so
+// the record is never both live and in the trash.
+func (env *TrashEnv) restore(ctx context.Context, item models.TrashItem) (interface{}, *unknownReferences, error) {
+	restored, add, unknown, err := env.restorable(ctx, item)
+	if err != nil || unknown != nil {
+		return nil, unknown, err
+	}
+
+	if err := env.Trash.DeleteOne(ctx, item.EntityID); err != nil {
+		return nil, nil, err
+	}
+	if err := add(); err != nil {
+		if undo := env.Trash.Add(ctx, item); undo != nil {
+			log.Printf("%v %v left the trash but was not restored: %v", item.EntityType, item.EntityID, undo)
+		}
+		return nil, nil, err
+	}
+	return restored, nil, nil
+}
+
+// restorable decodes the record of item and returns how to add it back. The
+// records it references must still exist: a product cannot come back before
+// its materials and lots, a lot before its material and supplier, a material
+// before its supplier, nor a certification before its subject.
+func (env *TrashEnv) restorable(ctx context.Context, item models.TrashItem) (interface{}, func() error, *unknownReferences, error) {
+	switch item.EntityType {
+	case models.EntityProduct:
+		var product models.Product
+		if err := json.Unmarshal(item.Record, &product); err != nil {
+			return nil, nil, nil, err
+		}
+		unknown, err := canonicalMaterials(ctx, env.Materials, &product)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(unknown) > 0 {
+			return nil, nil, &unknownReferences{Error: "unknown materials, restore them first", Materials: unknown}, nil
+		}
+		lots, err := productLots(ctx, env.Lots, product)
+		if err != nil || lots != nil {
+			return nil, nil, lots, err
+		}
+		return product, func() error { return env.Products.Add(ctx, product) }, nil, nil
+	case models.EntityMaterial:
+		var material models.Material
+		if err := json.Unmarshal(item.Record, &material); err != nil {
+			return nil, nil, nil, err
+		}
+		unknown, err := canonicalSupplier(ctx, env.Suppliers, &material)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(unknown) > 0 {
+			return nil, nil, &unknownReferences{Error: "unknown supplier, restore it first", Suppliers: unknown}, nil
+		}
+		return material, func() error { return env.Materials.Add(ctx, material) }, nil, nil
+	case models.EntitySupplier:
+		var supplier models.Supplier
+		if err := json.Unmarshal(item.Record, &supplier); err != nil {
+			return nil, nil, nil, err
+		}
+		return supplier, func() error { return env.Suppliers.Add(ctx, supplier) }, nil, nil
+	case models.EntityLot:
+		var lot models.Lot
+		if err := json.Unmarshal(item.Record, &lot); err != nil {
+			return nil, nil, nil, err
+		}
+		unknown, err := lotReferences(ctx, env.Materials, env.Suppliers, &lot)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if unknown != nil {
+			unknown.Error += ", restore it first"
+			return nil, nil, unknown, nil
+		}
+		return lot, func() error { return env.Lots.Add(ctx, lot) }, nil, nil
+	case models.EntityCert:
+		var cert models.Cert
+		if err := json.Unmarshal(item.Record, &cert); err != nil {
+			return nil, nil, nil, err
+		}
+		exists, err := certSubjectExists(ctx, env.Suppliers, env.Materials, env.Products, env.Lots, cert.Subject)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if !exists {
+			unknown := unknownSubject(cert.Subject)
+			unknown.Error += ", restore it first"
+			return nil, nil, &unknown, nil
+		}
+		return cert, func() error { return env.Certs.Add(ctx, cert) }, nil, nil
+	}
+	return nil, nil, nil, fmt.Errorf("cannot restore a %v", item.EntityType)
+}
+
+func (env *TrashEnv) PurgeHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		// /trash/purge?id=my_id
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		err := env.Trash.DeleteOne(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode("Purged from the trash")
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,155 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"marvinhagler/handlers"
+	"marvinhagler/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRestoreProduct(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+
+	w := s.do(http.MethodDelete, c.prefix+"/products/delete-product?id="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+	var items []models.TrashItem
+	w = s.do(http.MethodGet, c.prefix+"/trash/all?type=product", nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &items)
+	if len(items) != 1 || items[0].EntityID != c.product {
+		t.Fatalf("got trash %+v, want product %v", items, c.product)
+	}
+
+	w = s.do(http.MethodPost, c.prefix+"/trash/restore?id="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+	var product models.Product
+	w = s.do(http.MethodGet, c.prefix+"/products/find-product?id="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &product)
+	if product.Name != "Ring" {
+		t.Errorf("restored %+v, want the Ring", product)
+	}
+	w = s.do(http.MethodGet, c.prefix+"/trash/all", nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &items)
+	if len(items) != 0 {
+		t.Errorf("restored product left in the trash: %+v", items)
+	}
+
+	w = s.do(http.MethodPost, c.prefix+"/trash/restore?id="+c.product, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestRestoreMaterialBeforeSupplier(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+
+	w := s.do(http.MethodDelete, c.prefix+"/suppliers/delete-supplier?id="+c.supplier+"&cascade=true", nil)
+	expectStatus(t, w, http.StatusOK)
+
+	w = s.do(http.MethodPost, c.prefix+"/trash/restore?id="+c.material, nil)
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+	w = s.do(http.MethodPost, c.prefix+"/trash/restore?id="+c.product, nil)
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+
+	for _, id := range []string{c.supplier, c.material, c.product} {
+		w = s.do(http.MethodPost, c.prefix+"/trash/restore?id="+id, nil)
+		expectStatus(t, w, http.StatusOK)
+	}
+}
+
+func TestRestoreCascadedLot(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	lot := s.lot(c.prefix, c.material)
+	band := s.add(c.prefix+"/products/add", map[string]interface{}{
+		"name": "Band", "materials": []map[string]string{{"id": c.material}}, "lots": []string{lot},
+	})
+
+	w := s.do(http.MethodDelete, c.prefix+"/materials/delete-material?id="+c.material+"&cascade=true", nil)
+	expectStatus(t, w, http.StatusOK)
+	var items []models.TrashItem
+	w = s.do(http.MethodGet, c.prefix+"/trash?type=lot", nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &items)
+	if len(items) != 1 || items[0].EntityID != lot {
+		t.Fatalf("got trash %+v, want lot %v", items, lot)
+	}
+
+	w = s.do(http.MethodPost, c.prefix+"/trash/restore?id="+lot, nil)
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+	w = s.do(http.MethodPost, c.prefix+"/trash/restore?id="+c.material, nil)
+	expectStatus(t, w, http.StatusOK)
+	w = s.do(http.MethodPost, c.prefix+"/trash/restore?id="+band, nil)
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+
+	for _, id := range []string{lot, band} {
+		w = s.do(http.MethodPost, c.prefix+"/trash/restore?id="+id, nil)
+		expectStatus(t, w, http.StatusOK)
+	}
+	var product models.Product
+	w = s.do(http.MethodGet, c.prefix+"/products/find-product?id="+band, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &product)
+	if len(product.Lots) != 1 || product.Lots[0] != lot {
+		t.Errorf("restored %+v, want it made from lot %v", product, lot)
+	}
+}
+
+func TestRestoreCert(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	cert := s.add(c.prefix+"/certs/add", map[string]interface{}{
+		"name": "RJC", "subject": map[string]string{"type": models.SubjectSupplier, "id": c.supplier},
+	})
+
+	w := s.do(http.MethodDelete, c.prefix+"/certs/delete-cert?id="+cert, nil)
+	expectStatus(t, w, http.StatusOK)
+	var items []models.TrashItem
+	w = s.do(http.MethodGet, c.prefix+"/trash?type=cert", nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &items)
+	if len(items) != 1 || items[0].EntityID != cert {
+		t.Fatalf("got trash %+v, want cert %v", items, cert)
+	}
+
+	w = s.do(http.MethodPost, c.prefix+"/trash/restore?id="+cert, nil)
+	expectStatus(t, w, http.StatusOK)
+	w = s.do(http.MethodGet, c.prefix+"/certs/find-cert?id="+cert, nil)
+	expectStatus(t, w, http.StatusOK)
+}
+
+// failingProducts cannot add products
+type failingProducts struct {
+	models.ProductRepository
+}
+
+func (failingProducts) Add(ctx context.Context, product models.Product) error {
+	return errors.New("disk full")
+}
+
+func TestRestoreFailureKeepsTrashItem(t *testing.T) {
+	s := newTestServer(t)
+	c := s.catalog(s.company("acme"))
+	w := s.do(http.MethodDelete, c.prefix+"/products/delete-product?id="+c.product, nil)
+	expectStatus(t, w, http.StatusOK)
+
+	env := &handlers.TrashEnv{Trash: s.repos.Trash, Products: failingProducts{s.repos.Products}, Materials: s.repos.Materials, Suppliers: s.repos.Suppliers, Lots: s.repos.Lots, Certs: s.repos.Certs}
+	ctx := models.WithCompany(context.Background(), strings.TrimPrefix(c.prefix, "/companies/"))
+	r := httptest.NewRequest(http.MethodPost, "/trash/restore?id="+c.product, nil).WithContext(ctx)
+	w = httptest.NewRecorder()
+	env.RestoreHandler(w, r)
+	expectStatus(t, w, http.StatusInternalServerError)
+
+	if _, err := s.repos.Trash.GetOne(ctx, c.product); err != nil {
+		t.Errorf("product not back in the trash after a failed restore: %v", err)
+	}
+	if _, err := s.repos.Products.GetOne(ctx, c.product); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("product live after a failed restore: %v", err)
+	}
+}
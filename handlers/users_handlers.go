@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"marvinhagler/helpers"
+	"marvinhagler/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type UsersEnv struct {
+	Users    models.UserRepository
+	Sessions models.SessionRepository
+}
+
+// newUser is what clients send to create a user
+type newUser struct {
+	Email    string      `json:"email"`
+	Name     string      `json:"name"`
+	Role     models.Role `json:"role"`
+	Password string      `json:"password"`
+}
+
+// userChange is what clients send to update a user, the password is only
+// changed by its owner through /auth/password
+type userChange struct {
+	Id   string      `json:"id"`
+	Name string      `json:"name"`
+	Role models.Role `json:"role"`
+}
+
+// hashPassword checks password is long enough and returns its bcrypt hash,
+// bcrypt ignores anything past 72 bytes so longer passwords are refused
+func hashPassword(password string) (string, error) {
+	if len(password) < 8 || len(password) > 72 {
+		return "", fmt.Errorf("password must be between 8 and 72 characters")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func (env *UsersEnv) AddUserHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var userData newUser
+
+		err := json.NewDecoder(r.Body).Decode(&userData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("JSON Error: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		email := strings.ToLower(strings.TrimSpace(userData.Email))
+		if !strings.Contains(email, "@") {
+			http.Error(w, "A valid email is required", http.StatusBadRequest)
+			return
+		}
+		if !userData.Role.Valid() {
+			http.Error(w, fmt.Sprintf("Unknown role %q, use admin, buyer, production or auditor", userData.Role), http.StatusBadRequest)
+			return
+		}
+		hash, err := hashPassword(userData.Password)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		user := models.User{
+			Id:           helpers.GenerateId("U-"),
+			Email:        email,
+			Name:         userData.Name,
+			Role:         userData.Role,
+			PasswordHash: hash,
+			CreatedAt:    time.Now().UTC().Format(time.RFC3339),
+		}
+
+		err = env.Users.Add(r.Context(), user)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			if errors.Is(err, models.ErrDuplicate) {
+				http.Error(w, thisErr, http.StatusConflict)
+				return
+			}
+			http.Error(w, thisErr, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+
+		err = json.NewEncoder(w).Encode(user)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *UsersEnv) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		var userData userChange
+
+		err := json.NewDecoder(r.Body).Decode(&userData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("JSON Error: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !userData.Role.Valid() {
+			http.Error(w, fmt.Sprintf("Unknown role %q, use admin, buyer, production or auditor", userData.Role), http.StatusBadRequest)
+			return
+		}
+
+		user, err := env.Users.GetOne(r.Context(), userData.Id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		user.Name = userData.Name
+		user.Role = userData.Role
+
+		err = env.Users.Update(r.Context(), *user)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(user)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *UsersEnv) GetAllUsersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		users, err := env.Users.GetAll(r.Context())
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(users)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *UsersEnv) GetOneUserHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// /find-user?id=my_id
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		user, err := env.Users.GetOne(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(user)
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *UsersEnv) DeleteOneUserHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		// /delete-user?id=my_id
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		err := env.Users.DeleteOne(r.Context(), id)
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode("User deleted")
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (env *UsersEnv) RevokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		// /revoke-sessions?id=my_id
+		id := r.URL.Query().Get("id")
+		if len(id) < 20 || len(id) > 25 {
+			http.Error(w, "Wrong ID format", http.StatusBadRequest)
+			return
+		}
+
+		_, err := env.Users.GetOne(r.Context(), id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		err = env.Sessions.RevokeByUser(r.Context(), id, "")
+		if err != nil {
+			thisErr := fmt.Sprintf("%v", err)
+			http.Error(w, thisErr, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode("Sessions revoked")
+		if err != nil {
+			log.Println("Failed to encode response:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
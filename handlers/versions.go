@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"marvinhagler/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Products, materials, suppliers, certs and lots carry a version, sent as the ETag
+// of their responses. Updates must send it back in If-Match: when the record
+// changed in the meantime the update is refused with 412 Precondition Failed.
+// Reads of a past revision with ?at= send no ETag, there is nothing to update
+// with it.
+
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatch reads the version sent in If-Match, answering the client itself
+// when it is missing or malformed
+func ifMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" {
+		http.Error(w, "If-Match header required, send the ETag of the record you are updating", http.StatusPreconditionRequired)
+		return 0, false
+	}
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(value, "W/"), `"`))
+	if err != nil || version < 0 {
+		http.Error(w, "Wrong If-Match format, send the ETag of the record you are updating", http.StatusBadRequest)
+		return 0, false
+	}
+	return version, true
+}
+
+// updateError answers with the status matching an error returned by an update
+func updateError(w http.ResponseWriter, err error) {
+	thisErr := fmt.Sprintf("%v", err)
+	if errors.Is(err, models.ErrStale) {
+		http.Error(w, thisErr, http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, thisErr, http.StatusBadRequest)
+		return
+	}
+	http.Error(w, thisErr, http.StatusInternalServerError)
+}
@@ -0,0 +1,23 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// GenerateSecret returns prefix followed by 32 random bytes in hex, used for
+// API keys that are shown once and only stored hashed
+func GenerateSecret(prefix string) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(random), nil
+}
+
+// HashSecret returns the SHA-256 of secret in hex
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
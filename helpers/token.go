@@ -0,0 +1,59 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// TokenClaims are what a session token says about its holder
+type TokenClaims struct {
+	SessionID string `json:"sid"`
+	UserID    string `json:"uid"`
+	CompanyID string `json:"cid"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// SignToken encodes claims as base64url(JSON).base64url(HMAC-SHA256)
+func SignToken(secret []byte, claims TokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(tokenSignature(secret, encoded)), nil
+}
+
+// ParseToken checks the signature and expiry of token and returns its claims
+func ParseToken(secret []byte, token string) (TokenClaims, error) {
+	var claims TokenClaims
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return claims, ErrInvalidToken
+	}
+	sent, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sent, tokenSignature(secret, encoded)) {
+		return claims, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return claims, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func tokenSignature(secret []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -3,11 +3,17 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"github.com/joho/godotenv"
 	"log"
 	"marvinhagler/db"
 	"marvinhagler/handlers"
+	"marvinhagler/helpers"
+	"marvinhagler/middleware"
 	"marvinhagler/models"
+	"marvinhagler/monitor"
+	"marvinhagler/notify"
 	"marvinhagler/routes"
 	"net/http"
 	"os"
@@ -17,33 +23,95 @@ import (
 )
 
 func main() {
+	migrateEmbedded := flag.Bool("migrate-embedded", false,
+		"move the records embedded in MongoDB company documents to their own collections, then exit")
+	flag.Parse()
+
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
 	}
 
-	client, collection, err := db.ConnectMongoDB()
+	if *migrateEmbedded {
+		client, collection, err := db.ConnectMongoDB()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.DisconnectMongoDB(client)
+
+		if err := models.MigrateEmbeddedMongo(collection); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Migration completed")
+		return
+	}
+
+	repos, closeStorage, err := openStorage(os.Getenv("DB_DRIVER"))
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+	defer closeStorage()
+
+	productsEnv := &handlers.ProductsEnv{Products: repos.Products, Materials: repos.Materials, Lots: repos.Lots, Certs: repos.Certs, Audit: repos.Audit}
+	materialsEnv := &handlers.MaterialsEnv{Materials: repos.Materials, Products: repos.Products, Suppliers: repos.Suppliers, Lots: repos.Lots, Certs: repos.Certs, Audit: repos.Audit}
+	suppliersEnv := &handlers.SuppliersEnv{Suppliers: repos.Suppliers, Materials: repos.Materials, Products: repos.Products, Lots: repos.Lots, Certs: repos.Certs, Audit: repos.Audit}
+	certsEnv := &handlers.CertsEnv{Certs: repos.Certs, Suppliers: repos.Suppliers, Materials: repos.Materials, Products: repos.Products, Lots: repos.Lots, Audit: repos.Audit}
+	lotsEnv := &handlers.LotsEnv{Lots: repos.Lots, Materials: repos.Materials, Suppliers: repos.Suppliers, Products: repos.Products, Certs: repos.Certs, Audit: repos.Audit}
+	traceEnv := &handlers.TraceEnv{Lots: repos.Lots, Products: repos.Products, Materials: repos.Materials, Suppliers: repos.Suppliers}
+	companyEnv := &handlers.CompanyEnv{Company: repos.Company}
+	keysEnv := &handlers.KeysEnv{Keys: repos.APIKeys}
+	usersEnv := &handlers.UsersEnv{Users: repos.Users, Sessions: repos.Sessions}
+	auditEnv := &handlers.AuditEnv{Audit: repos.Audit}
+	trashEnv := &handlers.TrashEnv{Trash: repos.Trash, Products: repos.Products, Materials: repos.Materials, Suppliers: repos.Suppliers, Lots: repos.Lots, Certs: repos.Certs}
+
+	tokenSecret, tokenTTL, err := tokenSettings()
 	if err != nil {
 		log.Fatal(err)
 		return
 	}
-	defer db.DisconnectMongoDB(client)
+	authEnv := &handlers.AuthEnv{Users: repos.Users, Sessions: repos.Sessions, TokenSecret: tokenSecret, TokenTTL: tokenTTL}
 
-	productsEnv := &handlers.ProductsEnv{Products: &models.ProductModel{COLLECTION: collection}}
-	materialsEnv := &handlers.MaterialsEnv{Materials: &models.MaterialModel{COLLECTION: collection}}
-	suppliersEnv := &handlers.SuppliersEnv{Suppliers: &models.SupplierModel{COLLECTION: collection}}
-	certsEnv := &handlers.CertsEnv{Certs: &models.CertModel{COLLECTION: collection}}
-	companyEnv := &handlers.CompanyEnv{Company: &models.CompanyModel{COLLECTION: collection}}
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if err := startCertExpiryJob(jobs, repos); err != nil {
+		log.Fatal(err)
+		return
+	}
+	if err := startTrashPurgeJob(jobs, repos); err != nil {
+		log.Fatal(err)
+		return
+	}
 
 	mux := http.NewServeMux()
 	routes.ProductsRouter(mux, productsEnv)
 	routes.MaterialsRouter(mux, materialsEnv)
 	routes.SuppliersRouter(mux, suppliersEnv)
 	routes.CertsRouter(mux, certsEnv)
+	routes.LotsRouter(mux, lotsEnv)
+	routes.TraceRouter(mux, traceEnv)
 	routes.CompanyRouter(mux, companyEnv)
+	routes.KeysRouter(mux, keysEnv)
+	routes.UsersRouter(mux, usersEnv)
+	routes.AuthRouter(mux, authEnv)
+	routes.AuditRouter(mux, auditEnv)
+	routes.TrashRouter(mux, trashEnv)
+
+	auth := &middleware.Authenticator{
+		Keys:        repos.APIKeys,
+		Sessions:    repos.Sessions,
+		Users:       repos.Users,
+		TokenSecret: tokenSecret,
+		Public:      []string{"/auth/login"},
+	}
+	if adminKey := os.Getenv("ADMIN_API_KEY"); adminKey != "" {
+		auth.AdminKeyHash = helpers.HashSecret(adminKey)
+	} else {
+		log.Println("ADMIN_API_KEY is not declared, companies cannot be managed")
+	}
 
 	server := &http.Server{
 		Addr:    ":8080",
-		Handler: mux,
+		Handler: auth.Wrap(middleware.Tenancy(repos.Company, []string{"/company/", "/auth/"}, mux)),
 	}
 
 	// Start server
@@ -71,3 +139,132 @@ func main() {
 
 	log.Println("Server stopped")
 }
+
+// tokenSettings reads the secret signing session tokens from TOKEN_SECRET and
+// their lifetime from TOKEN_TTL (12h by default). Without a secret a random one
+// is used, so tokens stop working when the server restarts.
+func tokenSettings() ([]byte, time.Duration, error) {
+	ttl := 12 * time.Hour
+	if value := os.Getenv("TOKEN_TTL"); value != "" {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil || ttl <= 0 {
+			return nil, 0, fmt.Errorf("wrong TOKEN_TTL %q", value)
+		}
+	}
+
+	if secret := os.Getenv("TOKEN_SECRET"); secret != "" {
+		return []byte(secret), ttl, nil
+	}
+	log.Println("TOKEN_SECRET is not declared, users will have to log in again after a restart")
+	secret, err := helpers.GenerateSecret("")
+	return []byte(secret), ttl, err
+}
+
+// startCertExpiryJob checks the certifications every CERT_EXPIRY_INTERVAL
+// (24h by default, 0 disables the job) for the ones expiring within
+// CERT_EXPIRY_WITHIN (30d by default)
+func startCertExpiryJob(ctx context.Context, repos *models.Repositories) error {
+	interval := 24 * time.Hour
+	if value := os.Getenv("CERT_EXPIRY_INTERVAL"); value != "" {
+		var err error
+		if interval, err = time.ParseDuration(value); err != nil {
+			return fmt.Errorf("wrong CERT_EXPIRY_INTERVAL: %v", err)
+		}
+	}
+	if interval <= 0 {
+		return nil
+	}
+
+	within := os.Getenv("CERT_EXPIRY_WITHIN")
+	if within == "" {
+		within = "30d"
+	}
+	duration, err := monitor.ParseWithin(within)
+	if err != nil {
+		return fmt.Errorf("wrong CERT_EXPIRY_WITHIN: %v", err)
+	}
+
+	notifier, err := notify.FromEnv()
+	if err != nil {
+		return err
+	}
+
+	job := &monitor.CertExpiryJob{
+		Companies: repos.Company,
+		Certs:     repos.Certs,
+		Suppliers: repos.Suppliers,
+		Materials: repos.Materials,
+		Notifier:  notifier,
+		Within:    duration,
+		Interval:  interval,
+	}
+	go job.Run(ctx)
+	return nil
+}
+
+// startTrashPurgeJob empties every hour the trash items older than
+// TRASH_RETENTION (30d by default, 0 keeps them until purged by hand)
+func startTrashPurgeJob(ctx context.Context, repos *models.Repositories) error {
+	value := os.Getenv("TRASH_RETENTION")
+	if value == "" {
+		value = "30d"
+	}
+	retention, err := monitor.ParseWithin(value)
+	if err != nil {
+		return fmt.Errorf("wrong TRASH_RETENTION: %v", err)
+	}
+	if retention == 0 {
+		return nil
+	}
+
+	job := &monitor.TrashPurgeJob{
+		Trash:     repos.Trash,
+		Retention: retention,
+		Interval:  time.Hour,
+	}
+	go job.Run(ctx)
+	return nil
+}
+
+// openStorage builds the repositories for the backend declared in DB_DRIVER,
+// MongoDB is used when nothing is declared
+func openStorage(driver string) (*models.Repositories, func(), error) {
+	mode, err := models.ParseReferenceMode(os.Getenv("REFERENCE_MODE"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch driver {
+	case "", "mongodb":
+		client, collection, err := db.ConnectMongoDB()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := models.EnsureMongoIndexes(collection); err != nil {
+			db.DisconnectMongoDB(client)
+			return nil, nil, err
+		}
+		return models.NewMongoRepositories(collection, mode), func() { db.DisconnectMongoDB(client) }, nil
+	case "memory":
+		log.Println("Using in-memory storage, data will be lost on shutdown")
+		return models.NewMemoryRepositories(mode), func() {}, nil
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "weetracky.db"
+		}
+		conn, err := db.ConnectSQLite(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return models.NewSQLRepositories(conn), func() { db.DisconnectSQL(conn) }, nil
+	case "postgres":
+		conn, err := db.ConnectPostgres(os.Getenv("POSTGRES_URL"))
+		if err != nil {
+			return nil, nil, err
+		}
+		return models.NewSQLRepositories(conn), func() { db.DisconnectSQL(conn) }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown DB_DRIVER %q", driver)
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"marvinhagler/helpers"
+	"marvinhagler/models"
+	"net/http"
+	"strings"
+)
+
+// Authenticator requires every request, except those on the Public path
+// prefixes, to carry a session token in the Authorization: Bearer header or an
+// API key in the X-API-Key header. Tokens and company keys scope the request
+// to their company and carry the role of their user or key, the admin key
+// (AdminKeyHash, the SHA-256 of ADMIN_API_KEY) can reach every company and
+// holds every permission.
+type Authenticator struct {
+	Keys         models.APIKeyRepository
+	Sessions     models.SessionRepository
+	Users        models.UserRepository
+	TokenSecret  []byte
+	AdminKeyHash string
+	Public       []string
+}
+
+func (a *Authenticator) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range a.Public {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		var principal models.Principal
+		var err error
+		key := r.Header.Get("X-API-Key")
+		token, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		switch {
+		case bearer:
+			principal, err = a.session(r, token)
+			if errors.Is(err, models.ErrNotFound) || errors.Is(err, helpers.ErrInvalidToken) {
+				unauthorized(w, "Invalid or expired token, log in again")
+				return
+			}
+		case key != "":
+			principal, err = a.principal(r, key)
+			if errors.Is(err, models.ErrNotFound) {
+				unauthorized(w, "Invalid API key")
+				return
+			}
+		default:
+			unauthorized(w, "Missing credentials, send a token in the Authorization: Bearer header or an API key in the X-API-Key header")
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		ctx := models.WithPrincipal(r.Context(), principal)
+		if principal.CompanyID != "" {
+			ctx = models.WithCompany(ctx, principal.CompanyID)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// principal returns who key belongs to, ErrNotFound if it is unknown or revoked
+func (a *Authenticator) principal(r *http.Request, key string) (models.Principal, error) {
+	hash := helpers.HashSecret(key)
+	if a.AdminKeyHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(a.AdminKeyHash)) == 1 {
+		return models.Principal{Admin: true}, nil
+	}
+
+	found, err := a.Keys.FindByHash(r.Context(), hash)
+	if err != nil {
+		return models.Principal{}, err
+	}
+	if found.Revoked {
+		return models.Principal{}, fmt.Errorf("API key %v is revoked: %w", found.Id, models.ErrNotFound)
+	}
+	role := found.Role
+	if role == "" {
+		// keys created before roles could do everything
+		role = models.RoleAdmin
+	}
+	return models.Principal{CompanyID: found.CompanyID, KeyID: found.Id, Role: role}, nil
+}
+
+// session returns the user a token was given to, with their current role,
+// ErrNotFound if its session is revoked or expired
+func (a *Authenticator) session(r *http.Request, token string) (models.Principal, error) {
+	claims, err := helpers.ParseToken(a.TokenSecret, token)
+	if err != nil {
+		return models.Principal{}, err
+	}
+
+	session, err := a.Sessions.GetOne(r.Context(), claims.SessionID)
+	if err != nil {
+		return models.Principal{}, err
+	}
+	if session.Revoked || session.UserID != claims.UserID || session.CompanyID != claims.CompanyID {
+		return models.Principal{}, fmt.Errorf("session %v is revoked: %w", session.Id, models.ErrNotFound)
+	}
+
+	user, err := a.Users.GetOne(models.WithCompany(r.Context(), session.CompanyID), session.UserID)
+	if err != nil {
+		return models.Principal{}, err
+	}
+	return models.Principal{CompanyID: session.CompanyID, UserID: user.Id, SessionID: session.Id, Role: user.Role}, nil
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer, ApiKey header="X-API-Key"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
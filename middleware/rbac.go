@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"fmt"
+	"marvinhagler/models"
+	"net/http"
+)
+
+// Require only lets through the requests whose principal holds permission,
+// the others get 403 naming the missing permission
+func Require(permission models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := models.PrincipalFrom(r.Context())
+		if !principal.Can(permission) {
+			http.Error(w, fmt.Sprintf("Missing permission %v", permission), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// RequireForParam also requires permission when the request sets the query
+// parameter param, e.g. reads of a past revision with ?at= need the audit log
+func RequireForParam(param string, permission models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has(param) {
+			Require(permission, next)(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
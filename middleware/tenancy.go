@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"marvinhagler/models"
+	"net/http"
+	"strings"
+)
+
+// Tenancy scopes every request to a company. Company data is served under
+// /companies/{id}/..., e.g. /companies/{id}/products/all: the company is looked
+// up, stored in the request context and the prefix removed before next sees
+// the request. Company keys can only reach their own company, and requests
+// without the prefix are scoped to it. Paths starting with one of the global
+// prefixes need no company.
+func Tenancy(companies models.CompanyRepository, global []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rest, found := strings.CutPrefix(r.URL.Path, "/companies/"); found {
+			id, path, _ := strings.Cut(rest, "/")
+			if id == "" || path == "" {
+				http.NotFound(w, r)
+				return
+			}
+
+			if principal, ok := models.PrincipalFrom(r.Context()); ok && !principal.Admin && principal.CompanyID != id {
+				http.Error(w, "This key belongs to another company", http.StatusForbidden)
+				return
+			}
+
+			_, err := companies.GetOne(r.Context(), id)
+			if errors.Is(err, models.ErrNotFound) {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				return
+			}
+
+			scoped := r.Clone(models.WithCompany(r.Context(), id))
+			scoped.URL.Path = "/" + path
+			scoped.URL.RawPath = ""
+			next.ServeHTTP(w, scoped)
+			return
+		}
+
+		for _, prefix := range global {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if _, ok := models.CompanyFrom(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, "No company selected, use /companies/{id}"+r.URL.Path, http.StatusBadRequest)
+	})
+}
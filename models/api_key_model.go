@@ -0,0 +1,111 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"time"
+)
+
+// APIKey grants access to the records of one company. Only the SHA-256 of the
+// key is stored, Prefix keeps its first characters so it can be recognised.
+type APIKey struct {
+	Id        string `json:"id" bson:"id"`
+	Name      string `json:"name" bson:"name"`
+	Prefix    string `json:"prefix" bson:"prefix"`
+	Role      Role   `json:"role" bson:"role"`
+	Hash      string `json:"-" bson:"hash"`
+	CreatedAt string `json:"createdAt" bson:"createdAt"`
+	Revoked   bool   `json:"revoked" bson:"revoked"`
+	CompanyID string `json:"-" bson:"-"`
+}
+
+// apiKeyDocument is how an API key is stored in the api_keys collection
+type apiKeyDocument struct {
+	CompanyID primitive.ObjectID `bson:"company_id"`
+	APIKey    `bson:",inline"`
+}
+
+type APIKeyModel struct {
+	COLLECTION *mongo.Collection
+}
+
+// APIKeyModel methods
+func (k *APIKeyModel) Add(ctx context.Context, key APIKey) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = k.COLLECTION.InsertOne(ctx, apiKeyDocument{companyID, key})
+	if err != nil {
+		log.Println("Failed to insert API key: ", err)
+		return err
+	}
+	return nil
+}
+
+func (k *APIKeyModel) GetAll(ctx context.Context) ([]APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []apiKeyDocument
+	if err := findAll(ctx, k.COLLECTION, bson.M{"company_id": companyID}, &documents); err != nil {
+		return nil, err
+	}
+
+	keys := make([]APIKey, 0, len(documents))
+	for _, document := range documents {
+		keys = append(keys, document.APIKey)
+	}
+	return keys, nil
+}
+
+// FindByHash looks a key up in every company, its CompanyID is set
+func (k *APIKeyModel) FindByHash(ctx context.Context, hash string) (*APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var document apiKeyDocument
+	err := k.COLLECTION.FindOne(ctx, bson.M{"hash": hash}).Decode(&document)
+	if isNoDocuments(err) {
+		return nil, fmt.Errorf("API key %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	document.APIKey.CompanyID = document.CompanyID.Hex()
+	return &document.APIKey, nil
+}
+
+func (k *APIKeyModel) Revoke(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"company_id": companyID, "id": id}
+	res, err := k.COLLECTION.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("API key with ID %v %w", id, ErrNotFound)
+	}
+	log.Printf("revoked API key %v", id)
+	return nil
+}
@@ -0,0 +1,402 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Every add, update and delete of products, materials, suppliers, certs, lots
+// and companies is recorded in an append-only audit log. The repositories returned
+// by the New*Repositories constructors are wrapped so no caller can skip it.
+
+const (
+	EntityProduct  = "product"
+	EntityMaterial = "material"
+	EntitySupplier = "supplier"
+	EntityCert     = "cert"
+	EntityLot      = "lot"
+	EntityCompany  = "company"
+
+	OperationAdd    = "add"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+// AuditTimeLayout has a fixed width so timestamps sort as strings
+const AuditTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// AuditEntry is one change to one record. Before and After are the whole
+// record as JSON, missing on add and delete respectively, Diff only lists the
+// fields that changed.
+type AuditEntry struct {
+	Actor      string                 `json:"actor" bson:"actor"`
+	Timestamp  string                 `json:"timestamp" bson:"timestamp"`
+	EntityType string                 `json:"entityType" bson:"entityType"`
+	EntityID   string                 `json:"entityId" bson:"entityId"`
+	Operation  string                 `json:"operation" bson:"operation"`
+	Before     json.RawMessage        `json:"before,omitempty" bson:"before,omitempty"`
+	After      json.RawMessage        `json:"after,omitempty" bson:"after,omitempty"`
+	Diff       map[string]FieldChange `json:"diff,omitempty" bson:"diff,omitempty"`
+	CompanyID  string                 `json:"-" bson:"-"`
+}
+
+// FieldChange is the value of a field before and after a change
+type FieldChange struct {
+	Before json.RawMessage `json:"before,omitempty" bson:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty" bson:"after,omitempty"`
+}
+
+// AuditRepository stores the audit log of the company in the context. There
+// is no way to change or remove an entry.
+type AuditRepository interface {
+	Add(ctx context.Context, entry AuditEntry) error
+	GetByEntity(ctx context.Context, entityID string) ([]AuditEntry, error)
+}
+
+// actor names who is making the request in ctx, "system" for the background
+// jobs running without one
+func actor(ctx context.Context) string {
+	principal, ok := PrincipalFrom(ctx)
+	switch {
+	case !ok:
+		return "system"
+	case principal.UserID != "":
+		return "user:" + principal.UserID
+	case principal.KeyID != "":
+		return "key:" + principal.KeyID
+	case principal.Admin:
+		return "admin"
+	}
+	return "unknown"
+}
+
+// diffFields compares two JSON objects field by field
+func diffFields(before, after json.RawMessage) map[string]FieldChange {
+	var old, new map[string]json.RawMessage
+	json.Unmarshal(before, &old)
+	json.Unmarshal(after, &new)
+
+	diff := map[string]FieldChange{}
+	for field, value := range old {
+		if !bytes.Equal(value, new[field]) {
+			diff[field] = FieldChange{Before: value, After: new[field]}
+		}
+	}
+	for field, value := range new {
+		if _, ok := old[field]; !ok {
+			diff[field] = FieldChange{After: value}
+		}
+	}
+	return diff
+}
+
+// record builds the entry for a change of the record with the given type and
+// ID and appends it to audit. before and after are nil on add and delete.
+// before is read ahead of the write, an update only goes through when its
+// version is the one updated. after is the record as written, with its new
+// version, rather than read back where a later write could already show.
+// The change is already saved, so failing to record it is only logged:
+// answering with an error would have the client retry a write that happened.
+func record(ctx context.Context, audit AuditRepository, entityType, entityID, operation string, before, after interface{}) {
+	entry := AuditEntry{
+		Actor:      actor(ctx),
+		Timestamp:  time.Now().UTC().Format(AuditTimeLayout),
+		EntityType: entityType,
+		EntityID:   entityID,
+		Operation:  operation,
+	}
+	var err error
+	if before != nil {
+		if entry.Before, err = json.Marshal(before); err != nil {
+			unaudited(entityType, entityID, err)
+			return
+		}
+	}
+	if after != nil {
+		if entry.After, err = json.Marshal(after); err != nil {
+			unaudited(entityType, entityID, err)
+			return
+		}
+	}
+	entry.Diff = diffFields(entry.Before, entry.After)
+
+	if err := audit.Add(ctx, entry); err != nil {
+		unaudited(entityType, entityID, err)
+	}
+}
+
+// unaudited logs a change that was saved but could not be recorded
+func unaudited(entityType, entityID string, err error) {
+	log.Printf("%v %v saved but not audited: %v", entityType, entityID, err)
+}
+
+// withAudit wraps the repositories of repos that are audited
+func withAudit(repos *Repositories) *Repositories {
+	repos.Products = &auditedProducts{repos.Products, repos.Audit}
+	repos.Materials = &auditedMaterials{repos.Materials, repos.Audit}
+	repos.Suppliers = &auditedSuppliers{repos.Suppliers, repos.Audit}
+	repos.Certs = &auditedCerts{repos.Certs, repos.Audit}
+	repos.Lots = &auditedLots{repos.Lots, repos.Audit}
+	repos.Company = &auditedCompanies{repos.Company, repos.Audit}
+	return repos
+}
+
+type auditedProducts struct {
+	ProductRepository
+	log AuditRepository
+}
+
+func (a *auditedProducts) Add(ctx context.Context, product Product) error {
+	if err := a.ProductRepository.Add(ctx, product); err != nil {
+		return err
+	}
+	record(ctx, a.log, EntityProduct, product.Id, OperationAdd, nil, product)
+	return nil
+}
+
+func (a *auditedProducts) Update(ctx context.Context, product Product) error {
+	before, err := a.ProductRepository.GetOne(ctx, product.Id)
+	if err != nil {
+		return err
+	}
+	if before.Version != product.Version {
+		return fmt.Errorf("product %v %w", product.Id, ErrStale)
+	}
+	if err := a.ProductRepository.Update(ctx, product); err != nil {
+		return err
+	}
+	product.Version++
+	record(ctx, a.log, EntityProduct, product.Id, OperationUpdate, before, product)
+	return nil
+}
+
+func (a *auditedProducts) DeleteOne(ctx context.Context, id string) error {
+	before, err := a.ProductRepository.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := a.ProductRepository.DeleteOne(ctx, id); err != nil {
+		return err
+	}
+	record(ctx, a.log, EntityProduct, id, OperationDelete, before, nil)
+	return nil
+}
+
+type auditedMaterials struct {
+	MaterialRepository
+	log AuditRepository
+}
+
+func (a *auditedMaterials) Add(ctx context.Context, material Material) error {
+	if err := a.MaterialRepository.Add(ctx, material); err != nil {
+		return err
+	}
+	record(ctx, a.log, EntityMaterial, material.Id, OperationAdd, nil, material)
+	return nil
+}
+
+func (a *auditedMaterials) Update(ctx context.Context, material Material) error {
+	before, err := a.MaterialRepository.GetOne(ctx, material.Id)
+	if err != nil {
+		return err
+	}
+	if before.Version != material.Version {
+		return fmt.Errorf("material %v %w", material.Id, ErrStale)
+	}
+	if err := a.MaterialRepository.Update(ctx, material); err != nil {
+		return err
+	}
+	material.Version++
+	record(ctx, a.log, EntityMaterial, material.Id, OperationUpdate, before, material)
+	return nil
+}
+
+func (a *auditedMaterials) DeleteOne(ctx context.Context, id string) error {
+	before, err := a.MaterialRepository.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := a.MaterialRepository.DeleteOne(ctx, id); err != nil {
+		return err
+	}
+	record(ctx, a.log, EntityMaterial, id, OperationDelete, before, nil)
+	return nil
+}
+
+type auditedSuppliers struct {
+	SupplierRepository
+	log AuditRepository
+}
+
+func (a *auditedSuppliers) Add(ctx context.Context, supplier Supplier) error {
+	if err := a.SupplierRepository.Add(ctx, supplier); err != nil {
+		return err
+	}
+	record(ctx, a.log, EntitySupplier, supplier.Id, OperationAdd, nil, supplier)
+	return nil
+}
+
+func (a *auditedSuppliers) Update(ctx context.Context, supplier Supplier) error {
+	before, err := a.SupplierRepository.GetOne(ctx, supplier.Id)
+	if err != nil {
+		return err
+	}
+	if before.Version != supplier.Version {
+		return fmt.Errorf("supplier %v %w", supplier.Id, ErrStale)
+	}
+	if err := a.SupplierRepository.Update(ctx, supplier); err != nil {
+		return err
+	}
+	supplier.Version++
+	record(ctx, a.log, EntitySupplier, supplier.Id, OperationUpdate, before, supplier)
+	return nil
+}
+
+func (a *auditedSuppliers) DeleteOne(ctx context.Context, id string) error {
+	before, err := a.SupplierRepository.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := a.SupplierRepository.DeleteOne(ctx, id); err != nil {
+		return err
+	}
+	record(ctx, a.log, EntitySupplier, id, OperationDelete, before, nil)
+	return nil
+}
+
+type auditedCerts struct {
+	CertRepository
+	log AuditRepository
+}
+
+func (a *auditedCerts) Add(ctx context.Context, cert Cert) error {
+	if err := a.CertRepository.Add(ctx, cert); err != nil {
+		return err
+	}
+	record(ctx, a.log, EntityCert, cert.Id, OperationAdd, nil, cert)
+	return nil
+}
+
+func (a *auditedCerts) Update(ctx context.Context, cert Cert) error {
+	before, err := a.CertRepository.GetOne(ctx, cert.Id)
+	if err != nil {
+		return err
+	}
+	if before.Version != cert.Version {
+		return fmt.Errorf("certification %v %w", cert.Id, ErrStale)
+	}
+	if err := a.CertRepository.Update(ctx, cert); err != nil {
+		return err
+	}
+	cert.Version++
+	record(ctx, a.log, EntityCert, cert.Id, OperationUpdate, before, cert)
+	return nil
+}
+
+func (a *auditedCerts) DeleteOne(ctx context.Context, id string) error {
+	before, err := a.CertRepository.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := a.CertRepository.DeleteOne(ctx, id); err != nil {
+		return err
+	}
+	record(ctx, a.log, EntityCert, id, OperationDelete, before, nil)
+	return nil
+}
+
+type auditedLots struct {
+	LotRepository
+	log AuditRepository
+}
+
+func (a *auditedLots) Add(ctx context.Context, lot Lot) error {
+	if err := a.LotRepository.Add(ctx, lot); err != nil {
+		return err
+	}
+	record(ctx, a.log, EntityLot, lot.Id, OperationAdd, nil, lot)
+	return nil
+}
+
+func (a *auditedLots) Update(ctx context.Context, lot Lot) error {
+	before, err := a.LotRepository.GetOne(ctx, lot.Id)
+	if err != nil {
+		return err
+	}
+	if before.Version != lot.Version {
+		return fmt.Errorf("lot %v %w", lot.Id, ErrStale)
+	}
+	if err := a.LotRepository.Update(ctx, lot); err != nil {
+		return err
+	}
+	lot.Version++
+	record(ctx, a.log, EntityLot, lot.Id, OperationUpdate, before, lot)
+	return nil
+}
+
+func (a *auditedLots) DeleteOne(ctx context.Context, id string) error {
+	before, err := a.LotRepository.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := a.LotRepository.DeleteOne(ctx, id); err != nil {
+		return err
+	}
+	record(ctx, a.log, EntityLot, id, OperationDelete, before, nil)
+	return nil
+}
+
+// auditedCompanies records company changes in the log of the company itself,
+// the log outlives the company so its deletion can still be looked up. Only
+// the name is recorded, the records of the company have their own entries.
+type auditedCompanies struct {
+	CompanyRepository
+	log AuditRepository
+}
+
+// companySnapshot is what the log keeps of a company
+type companySnapshot struct {
+	Id   string `json:"_id"`
+	Name string `json:"name"`
+}
+
+func (a *auditedCompanies) Initialize(ctx context.Context, company Company) error {
+	if err := a.CompanyRepository.Initialize(ctx, company); err != nil {
+		return err
+	}
+	id := company.ID.Hex()
+	ctx = WithCompany(ctx, id)
+	record(ctx, a.log, EntityCompany, id, OperationAdd, nil, companySnapshot{id, company.Name})
+	return nil
+}
+
+func (a *auditedCompanies) Rename(ctx context.Context, id string, name string) error {
+	before, err := a.CompanyRepository.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := a.CompanyRepository.Rename(ctx, id, name); err != nil {
+		return err
+	}
+	ctx = WithCompany(ctx, id)
+	record(ctx, a.log, EntityCompany, id, OperationUpdate, companySnapshot{id, before.Name}, companySnapshot{id, name})
+	return nil
+}
+
+func (a *auditedCompanies) DeleteOne(ctx context.Context, id string) error {
+	before, err := a.CompanyRepository.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := a.CompanyRepository.DeleteOne(ctx, id); err != nil {
+		return err
+	}
+	log.Printf("company %v deleted, its audit log is kept", id)
+	ctx = WithCompany(ctx, id)
+	record(ctx, a.log, EntityCompany, id, OperationDelete, companySnapshot{id, before.Name}, nil)
+	return nil
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"time"
+)
+
+// auditDocument is how an entry is stored in the audit collection
+type auditDocument struct {
+	CompanyID  primitive.ObjectID `bson:"company_id"`
+	AuditEntry `bson:",inline"`
+}
+
+type AuditModel struct {
+	COLLECTION *mongo.Collection
+}
+
+// AuditModel methods
+func (a *AuditModel) Add(ctx context.Context, entry AuditEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.COLLECTION.InsertOne(ctx, auditDocument{companyID, entry})
+	if err != nil {
+		log.Println("Failed to insert audit entry: ", err)
+		return err
+	}
+	return nil
+}
+
+func (a *AuditModel) GetByEntity(ctx context.Context, entityID string) ([]AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []auditDocument
+	if err := findAll(ctx, a.COLLECTION, bson.M{"company_id": companyID, "entityId": entityID}, &documents); err != nil {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, 0, len(documents))
+	for _, document := range documents {
+		entries = append(entries, document.AuditEntry)
+	}
+	return entries, nil
+}
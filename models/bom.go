@@ -0,0 +1,17 @@
+package models
+
+// BOMLine is one line of the bill of materials of a product: how much of a
+// material goes into one unit of it and how much of that is expected to be
+// lost while making it, in percent of the quantity
+type BOMLine struct {
+	MaterialID string  `json:"materialId" bson:"materialId"`
+	Quantity   float64 `json:"quantity" bson:"quantity"`
+	Unit       Unit    `json:"unit" bson:"unit"`
+	WastePct   float64 `json:"wastePct" bson:"wastePct"`
+}
+
+// Gross is the quantity of material needed to make units of the product,
+// waste included
+func (l BOMLine) Gross(units float64) float64 {
+	return l.Quantity * units * (1 + l.WastePct/100)
+}
@@ -2,23 +2,48 @@ package models
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
 	"log"
-	"os"
 	"time"
 )
 
 type Cert struct {
-	Id      string `json:"id" bson:"id"`
-	Name    string `json:"name" bson:"name"`
-	Issuer  string `json:"issuer" bson:"issuer"`
-	Details string `json:"details" bson:"details"`
+	Id         string      `json:"id" bson:"id"`
+	Name       string      `json:"name" bson:"name"`
+	Issuer     string      `json:"issuer" bson:"issuer"`
+	Details    string      `json:"details" bson:"details"`
+	Number     string      `json:"number" bson:"number"`
+	Scope      string      `json:"scope" bson:"scope"`
+	IssueDate  string      `json:"issueDate" bson:"issueDate"`
+	ExpiryDate string      `json:"expiryDate" bson:"expiryDate"`
+	Subject    CertSubject `json:"subject" bson:"subject"`
+	Version    int         `json:"version" bson:"version"`
+}
+
+// CertSubject is the supplier, material, product or material lot a
+// certification is about
+type CertSubject struct {
+	Type string `json:"type" bson:"type"`
+	Id   string `json:"id" bson:"id"`
+}
+
+const (
+	SubjectSupplier = "supplier"
+	SubjectMaterial = "material"
+	SubjectProduct  = "product"
+	SubjectLot      = "lot"
+)
+
+// CertDateLayout is the layout of IssueDate and ExpiryDate
+const CertDateLayout = "2006-01-02"
+
+// certDocument is how a certification is stored in the certs collection
+type certDocument struct {
+	CompanyID primitive.ObjectID `bson:"company_id"`
+	Cert      `bson:",inline"`
 }
 
 type CertModel struct {
@@ -26,27 +51,16 @@ type CertModel struct {
 }
 
 // CertModel methods
-func (c *CertModel) Add(cert Cert) error {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c *CertModel) Add(ctx context.Context, cert Cert) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	var result bson.M
-	err := c.COLLECTION.FindOne(ctx, bson.D{{"name", companyFirstLMaiusc}}).Decode(&result)
+	companyID, err := mongoCompanyID(ctx)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil
-		}
-		return nil
+		return err
 	}
 
-	filter := bson.D{{"name", companyFirstLMaiusc}}
-	update := bson.D{{"$push", bson.D{{"certs", cert}}}}
-
-	_, err = c.COLLECTION.UpdateOne(ctx, filter, update)
+	_, err = c.COLLECTION.InsertOne(ctx, certDocument{companyID, cert})
 	if err != nil {
 		log.Println("Failed to insert certification: ", err)
 		return err
@@ -54,51 +68,103 @@ func (c *CertModel) Add(cert Cert) error {
 	return nil
 }
 
-func (c *CertModel) GetAll() ([]Cert, error) {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c *CertModel) Update(ctx context.Context, cert Cert) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	var result bson.M
-
-	err := c.COLLECTION.FindOne(ctx, bson.D{{"name", companyFirstLMaiusc}}).Decode(&result)
+	companyID, err := mongoCompanyID(ctx)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, nil
-		}
-		return nil, err
+		return err
 	}
 
-	certsRaw, ok := result["certs"]
-	if !ok {
-		return nil, errors.New("field 'certs' not found")
+	filter := bson.M{"company_id": companyID, "id": cert.Id, "version": versionFilter(cert.Version)}
+	cert.Version++
+	res, err := c.COLLECTION.ReplaceOne(ctx, filter, certDocument{companyID, cert})
+	if err != nil {
+		return err
 	}
+	if res.MatchedCount != 0 {
+		log.Printf("matched and replaced certification %v", cert.Id)
+		return nil
+	}
+
+	return staleOrMissing(ctx, c.COLLECTION, companyID, "certification", cert.Id)
+}
 
-	certsJSON, err := json.Marshal(certsRaw)
+// find returns the certifications of the current company matching filter
+func (c *CertModel) find(ctx context.Context, filter bson.M) ([]Cert, error) {
+	companyID, err := mongoCompanyID(ctx)
 	if err != nil {
 		return nil, err
 	}
+	filter["company_id"] = companyID
 
-	var certs []Cert
-	err = json.Unmarshal(certsJSON, &certs)
-	if err != nil {
+	var documents []certDocument
+	if err := findAll(ctx, c.COLLECTION, filter, &documents); err != nil {
 		return nil, err
 	}
 
+	certs := make([]Cert, 0, len(documents))
+	for _, document := range documents {
+		certs = append(certs, document.Cert)
+	}
 	return certs, nil
 }
 
-// TODO: todo
-func (c *CertModel) GetOne(id string) (*Cert, error) {
-	return nil, fmt.Errorf("not implemented")
+func (c *CertModel) GetAll(ctx context.Context) ([]Cert, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return c.find(ctx, bson.M{})
+}
+
+func (c *CertModel) GetOne(ctx context.Context, id string) (*Cert, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	certs, err := c.find(ctx, bson.M{"id": id})
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) > 0 {
+		return &certs[0], nil
+	}
+
+	return nil, fmt.Errorf("certification with ID %v %w", id, ErrNotFound)
 }
-func (c *CertModel) Update(cert Cert) error {
-	return fmt.Errorf("not implemented")
+
+func (c *CertModel) GetBySubject(ctx context.Context, subjectID string) (*[]Cert, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	certs, err := c.find(ctx, bson.M{"subject.id": subjectID})
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) > 0 {
+		return &certs, nil
+	}
+
+	return nil, fmt.Errorf("certifications for subject with ID %v %w", subjectID, ErrNotFound)
 }
 
-func (c *CertModel) DeleteOne(id string) error {
-	return fmt.Errorf("not implemented")
+func (c *CertModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.COLLECTION.DeleteOne(ctx, bson.M{"company_id": companyID, "id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount != 0 {
+		log.Printf("matched and deleted certification %v", id)
+		return nil
+	}
+
+	return fmt.Errorf("certification with ID %v %w", id, ErrNotFound)
 }
@@ -2,8 +2,11 @@ package models
 
 import (
 	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
 	"time"
 )
@@ -11,27 +14,117 @@ import (
 type Company struct {
 	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
 	Name      string             `json:"name" bson:"name"`
-	Products  []Product          `json:"products" bson:"products"`
-	Materials []Material         `json:"materials" bson:"materials"`
-	Suppliers []Supplier         `json:"suppliers" bson:"suppliers"`
-	Certs     []Cert             `json:"certs" bson:"certs"`
+	Products  []Product          `json:"products,omitempty" bson:"products,omitempty"`
+	Materials []Material         `json:"materials,omitempty" bson:"materials,omitempty"`
+	Suppliers []Supplier         `json:"suppliers,omitempty" bson:"suppliers,omitempty"`
+	Certs     []Cert             `json:"certs,omitempty" bson:"certs,omitempty"`
+	Lots      []Lot              `json:"lots,omitempty" bson:"lots,omitempty"`
 }
 
 type CompanyModel struct {
 	COLLECTION *mongo.Collection
 }
 
-func (c *CompanyModel) Initialize(company Company) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// CompanyModel methods
+func (c *CompanyModel) Initialize(ctx context.Context, company Company) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	newCompany, err := c.COLLECTION.InsertOne(ctx, company)
-
+	newCompany, err := c.COLLECTION.InsertOne(ctx, Company{ID: company.ID, Name: company.Name})
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("company %v %w", company.Name, ErrDuplicate)
+	}
 	if err != nil {
-		log.Fatal(err)
+		log.Println("Failed to insert company: ", err)
 		return err
 	}
 
 	log.Printf("Created new company with ID %v\n", newCompany.InsertedID)
 	return nil
 }
+
+func (c *CompanyModel) GetAll(ctx context.Context) ([]Company, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := c.COLLECTION.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"name": 1}).SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	companies := []Company{}
+	if err := cursor.All(ctx, &companies); err != nil {
+		return nil, err
+	}
+	return companies, nil
+}
+
+func (c *CompanyModel) GetOne(ctx context.Context, id string) (*Company, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+	}
+
+	var company Company
+	err = c.COLLECTION.FindOne(ctx, bson.M{"_id": objectID}, options.FindOne().SetProjection(bson.M{"name": 1})).Decode(&company)
+	if isNoDocuments(err) {
+		return nil, fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &company, nil
+}
+
+func (c *CompanyModel) Rename(ctx context.Context, id string, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+	}
+
+	res, err := c.COLLECTION.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": bson.M{"name": name}})
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("company %v %w", name, ErrDuplicate)
+	}
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+	}
+	log.Printf("renamed company %v to %v", id, name)
+	return nil
+}
+
+// DeleteOne deletes the company and every record it owns
+func (c *CompanyModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+	}
+
+	res, err := c.COLLECTION.DeleteOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+	}
+
+	database := c.COLLECTION.Database()
+	for _, name := range []string{productsCollection, materialsCollection, suppliersCollection, certsCollection, lotsCollection, apiKeysCollection, usersCollection, sessionsCollection, trashCollection} {
+		if _, err := database.Collection(name).DeleteMany(ctx, bson.M{"company_id": objectID}); err != nil {
+			return fmt.Errorf("company %v deleted but its %v were not: %v", id, name, err)
+		}
+	}
+	log.Printf("matched and deleted company %v", id)
+	return nil
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoCompany is returned when a request reaches the models without a company
+var ErrNoCompany = errors.New("no company selected")
+
+type contextKey int
+
+const (
+	companyKey contextKey = iota
+	principalKey
+)
+
+// Principal is who is making a request: a user logged in with a session token,
+// an API key of a company, or the admin key that can manage every company
+type Principal struct {
+	CompanyID string
+	UserID    string
+	SessionID string
+	KeyID     string
+	Role      Role
+	Admin     bool
+}
+
+// WithPrincipal returns a copy of ctx carrying principal
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFrom returns the principal of the request ctx belongs to
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(Principal)
+	return principal, ok
+}
+
+// WithCompany returns a copy of ctx scoped to the company with the given ID,
+// every repository reads and writes only that company's records
+func WithCompany(ctx context.Context, companyID string) context.Context {
+	return context.WithValue(ctx, companyKey, companyID)
+}
+
+// CompanyFrom returns the ID of the company ctx is scoped to
+func CompanyFrom(ctx context.Context) (string, bool) {
+	companyID, ok := ctx.Value(companyKey).(string)
+	return companyID, ok && companyID != ""
+}
+
+// currentCompany is CompanyFrom for the backends, ErrNoCompany if there is none
+func currentCompany(ctx context.Context) (string, error) {
+	companyID, ok := CompanyFrom(ctx)
+	if !ok {
+		return "", ErrNoCompany
+	}
+	return companyID, nil
+}
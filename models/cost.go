@@ -0,0 +1,42 @@
+package models
+
+// UnitCost is what one unit of measure of a material costs from a day on.
+// The costs of a material are its price history, EffectiveFrom is YYYY-MM-DD
+// like the certification dates.
+type UnitCost struct {
+	Cost          float64 `json:"cost" bson:"cost"`
+	Unit          Unit    `json:"unit" bson:"unit"`
+	EffectiveFrom string  `json:"effectiveFrom" bson:"effectiveFrom"`
+}
+
+// CostLine is labor or overhead going into one unit of a product
+type CostLine struct {
+	Kind   string  `json:"kind" bson:"kind"`
+	Name   string  `json:"name" bson:"name"`
+	Amount float64 `json:"amount" bson:"amount"`
+}
+
+const (
+	CostLabor    = "labor"
+	CostOverhead = "overhead"
+)
+
+// CostKinds lists the kinds of cost lines of a product
+var CostKinds = []string{CostLabor, CostOverhead}
+
+// CostOn returns the cost of unit in effect on day, the one with the latest
+// EffectiveFrom not after it. Dates compare as strings since they all are
+// YYYY-MM-DD.
+func CostOn(costs []UnitCost, unit Unit, day string) (UnitCost, bool) {
+	var current UnitCost
+	found := false
+	for _, cost := range costs {
+		if cost.Unit != unit || cost.EffectiveFrom > day {
+			continue
+		}
+		if !found || cost.EffectiveFrom >= current.EffectiveFrom {
+			current, found = cost, true
+		}
+	}
+	return current, found
+}
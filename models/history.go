@@ -0,0 +1,69 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// The audit log doubles as the revision history of every record: the After of
+// each entry is the record as it was from that moment until the next entry.
+
+// Revision is a record as it was after one of its changes, Record is missing
+// once it was deleted
+type Revision struct {
+	Number    int             `json:"revision"`
+	Timestamp string          `json:"timestamp"`
+	Actor     string          `json:"actor"`
+	Operation string          `json:"operation"`
+	Record    json.RawMessage `json:"record,omitempty"`
+}
+
+// Revisions lists the revisions of the record with the given ID, oldest first
+func Revisions(ctx context.Context, audit AuditRepository, entityID string) ([]Revision, error) {
+	entries, err := audit.GetByEntity(ctx, entityID)
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]Revision, 0, len(entries))
+	for i, entry := range entries {
+		revisions = append(revisions, Revision{
+			Number:    i + 1,
+			Timestamp: entry.Timestamp,
+			Actor:     entry.Actor,
+			Operation: entry.Operation,
+			Record:    entry.After,
+		})
+	}
+	return revisions, nil
+}
+
+// RecordAt decodes into out the record of the given type and ID as it was at
+// time at, ErrNotFound if it did not exist then or changed before the audit
+// log was kept
+func RecordAt(ctx context.Context, audit AuditRepository, entityType, entityID string, at time.Time, out interface{}) error {
+	entries, err := audit.GetByEntity(ctx, entityID)
+	if err != nil {
+		return err
+	}
+
+	var record json.RawMessage
+	for _, entry := range entries {
+		if entry.EntityType != entityType {
+			continue
+		}
+		changed, err := time.Parse(AuditTimeLayout, entry.Timestamp)
+		if err != nil {
+			return err
+		}
+		if changed.After(at) {
+			break
+		}
+		record = entry.After
+	}
+	if record == nil {
+		return fmt.Errorf("%v with ID %v at %v %w", entityType, entityID, at.Format(time.RFC3339), ErrNotFound)
+	}
+	return json.Unmarshal(record, out)
+}
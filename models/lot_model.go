@@ -0,0 +1,145 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"time"
+)
+
+// Lot is one delivery of a material, products list the lots they were made
+// from so a delivery can be traced to the products it went into and back
+type Lot struct {
+	Id         string  `json:"id" bson:"id"`
+	MaterialID string  `json:"materialId" bson:"materialId"`
+	SupplierID string  `json:"supplierId" bson:"supplierId"`
+	Quantity   float64 `json:"quantity" bson:"quantity"`
+	Unit       Unit    `json:"unit" bson:"unit"`
+	ReceivedAt string  `json:"receivedAt" bson:"receivedAt"`
+	Assay      string  `json:"assay" bson:"assay"`
+	Version    int     `json:"version" bson:"version"`
+}
+
+// lotDocument is how a lot is stored in the lots collection
+type lotDocument struct {
+	CompanyID primitive.ObjectID `bson:"company_id"`
+	Lot       `bson:",inline"`
+}
+
+type LotModel struct {
+	COLLECTION *mongo.Collection
+}
+
+// LotModel methods
+func (l *LotModel) Add(ctx context.Context, lot Lot) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.COLLECTION.InsertOne(ctx, lotDocument{companyID, lot})
+	if err != nil {
+		log.Println("Failed to insert lot: ", err)
+		return err
+	}
+	return nil
+}
+
+func (l *LotModel) Update(ctx context.Context, lot Lot) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"company_id": companyID, "id": lot.Id, "version": versionFilter(lot.Version)}
+	lot.Version++
+	res, err := l.COLLECTION.ReplaceOne(ctx, filter, lotDocument{companyID, lot})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount != 0 {
+		log.Printf("matched and replaced lot %v", lot.Id)
+		return nil
+	}
+
+	return staleOrMissing(ctx, l.COLLECTION, companyID, "lot", lot.Id)
+}
+
+// find returns the lots of the current company matching filter
+func (l *LotModel) find(ctx context.Context, filter bson.M) ([]Lot, error) {
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter["company_id"] = companyID
+
+	var documents []lotDocument
+	if err := findAll(ctx, l.COLLECTION, filter, &documents); err != nil {
+		return nil, err
+	}
+
+	lots := make([]Lot, 0, len(documents))
+	for _, document := range documents {
+		lots = append(lots, document.Lot)
+	}
+	return lots, nil
+}
+
+func (l *LotModel) GetAll(ctx context.Context) ([]Lot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return l.find(ctx, bson.M{})
+}
+
+func (l *LotModel) GetOne(ctx context.Context, id string) (*Lot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	lots, err := l.find(ctx, bson.M{"id": id})
+	if err != nil {
+		return nil, err
+	}
+	if len(lots) > 0 {
+		return &lots[0], nil
+	}
+
+	return nil, fmt.Errorf("lot with ID %v %w", id, ErrNotFound)
+}
+
+func (l *LotModel) GetByMaterial(ctx context.Context, materialID string) ([]Lot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return l.find(ctx, bson.M{"materialId": materialID})
+}
+
+func (l *LotModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := l.COLLECTION.DeleteOne(ctx, bson.M{"company_id": companyID, "id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount != 0 {
+		log.Printf("matched and deleted lot %v", id)
+		return nil
+	}
+
+	return fmt.Errorf("lot with ID %v %w", id, ErrNotFound)
+}
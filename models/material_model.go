@@ -2,55 +2,50 @@ package models
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
-	"os"
 	"time"
 )
 
 type Material struct {
-	Id          string   `json:"id" bson:"id"`
-	Name        string   `json:"name" bson:"name"`
-	Supplier    Supplier `json:"supplier" bson:"supplier"`
-	Origin      string   `json:"origin" bson:"origin"`
-	Sustainable bool     `json:"sustainable" bson:"sustainable"`
-	Details     string   `json:"details" bson:"details"`
-	LastOrder   string   `json:"lastOrder" bson:"lastOrder"`
+	Id          string        `json:"id" bson:"id"`
+	Name        string        `json:"name" bson:"name"`
+	Supplier    Supplier      `json:"supplier" bson:"supplier"`
+	Origin      string        `json:"origin" bson:"origin"`
+	Provenance  []CustodyStep `json:"provenance" bson:"provenance"`
+	Costs       []UnitCost    `json:"costs" bson:"costs"`
+	Sustainable bool          `json:"sustainable" bson:"sustainable"`
+	Details     string        `json:"details" bson:"details"`
+	LastOrder   string        `json:"lastOrder" bson:"lastOrder"`
+	Version     int           `json:"version" bson:"version"`
+}
+
+// materialDocument is how a material is stored in the materials collection
+type materialDocument struct {
+	CompanyID primitive.ObjectID `bson:"company_id"`
+	Material  `bson:",inline"`
 }
 
 type MaterialModel struct {
 	COLLECTION *mongo.Collection
+	REFERENCES ReferenceMode
 }
 
 // MaterialModel methods
-func (m *MaterialModel) Add(material Material) error {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (m *MaterialModel) Add(ctx context.Context, material Material) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	var result bson.M
-	err := m.COLLECTION.FindOne(ctx, bson.D{{"name", companyFirstLMaiusc}}).Decode(&result)
-
+	companyID, err := mongoCompanyID(ctx)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil
-		}
 		return err
 	}
 
-	filter := bson.D{{"name", companyFirstLMaiusc}}
-	update := bson.D{{"$push", bson.D{{"materials", material}}}}
-
-	_, err = m.COLLECTION.UpdateOne(ctx, filter, update)
+	_, err = m.COLLECTION.InsertOne(ctx, materialDocument{companyID, storedMaterial(material, m.REFERENCES)})
 	if err != nil {
 		log.Println("Failed to insert material: ", err)
 		return err
@@ -58,207 +53,129 @@ func (m *MaterialModel) Add(material Material) error {
 	return nil
 }
 
-func (m *MaterialModel) Update(material Material) error {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (m *MaterialModel) Update(ctx context.Context, material Material) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{"name": companyFirstLMaiusc, "materials.id": material.Id}
-	update := bson.D{{"$set", bson.D{{"materials.$", material}}}}
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
 
-	res, err := m.COLLECTION.UpdateOne(ctx, filter, update)
+	filter := bson.M{"company_id": companyID, "id": material.Id, "version": versionFilter(material.Version)}
+	material.Version++
+	res, err := m.COLLECTION.ReplaceOne(ctx, filter, materialDocument{companyID, storedMaterial(material, m.REFERENCES)})
 	if err != nil {
 		return err
 	}
-	if res.MatchedCount != 0 {
-		log.Printf("matched and replaced material %v", material.Id)
-		return nil
+	if res.MatchedCount == 0 {
+		return staleOrMissing(ctx, m.COLLECTION, companyID, "material", material.Id)
 	}
+	log.Printf("matched and replaced material %v", material.Id)
 
-	return errors.New("material not found")
-}
-
-func (m *MaterialModel) GetAll() ([]Material, error) {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var result bson.M
-
-	err := m.COLLECTION.FindOne(ctx, bson.D{{"name", companyFirstLMaiusc}}).Decode(&result)
-	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, nil
+	// the material is saved, copies left stale by a failed propagation are
+	// replaced again on its next update
+	if m.REFERENCES == ReferenceEmbedded {
+		if err := m.propagate(ctx, companyID, material); err != nil {
+			log.Printf("material %v updated but its copies were not: %v", material.Id, err)
 		}
-		return nil, err
 	}
+	return nil
+}
 
-	materialsRaw, ok := result["materials"]
-	if !ok {
-		return nil, errors.New("field 'materials' not found")
+// propagate replaces the copies of material embedded in products
+func (m *MaterialModel) propagate(ctx context.Context, companyID primitive.ObjectID, material Material) error {
+	filter := bson.M{"company_id": companyID, "materials.id": material.Id}
+	update := bson.M{"$set": bson.M{"materials.$[m]": material}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"m.id": material.Id}},
+	})
+	if _, err := m.COLLECTION.Database().Collection(productsCollection).UpdateMany(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf("products: %v", err)
 	}
+	return nil
+}
 
-	materialsJSON, err := json.Marshal(materialsRaw)
+// find returns the materials of the current company matching filter
+func (m *MaterialModel) find(ctx context.Context, filter bson.M) ([]Material, error) {
+	companyID, err := mongoCompanyID(ctx)
 	if err != nil {
 		return nil, err
 	}
+	filter["company_id"] = companyID
 
-	var materials []Material
-	err = json.Unmarshal(materialsJSON, &materials)
-	if err != nil {
+	var documents []materialDocument
+	if err := findAll(ctx, m.COLLECTION, filter, &documents); err != nil {
 		return nil, err
 	}
 
+	materials := make([]Material, 0, len(documents))
+	for _, document := range documents {
+		materials = append(materials, document.Material)
+	}
+
+	if m.REFERENCES != ReferenceEmbedded {
+		if err := resolveMongoMaterials(ctx, m.COLLECTION.Database(), companyID, materials); err != nil {
+			return nil, err
+		}
+	}
 	return materials, nil
 }
 
-func (m *MaterialModel) GetOne(id string) (*Material, error) {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (m *MaterialModel) GetAll(ctx context.Context) ([]Material, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	pipeline := bson.A{
-		bson.D{
-			{"$match", bson.D{{"name", companyFirstLMaiusc}}},
-		},
-		bson.D{
-			{"$unwind", "$materials"},
-		},
-		bson.D{
-			{"$match", bson.D{{"materials.id", id}}},
-		},
-	}
+	return m.find(ctx, bson.M{})
+}
 
-	cursor, err := m.COLLECTION.Aggregate(ctx, pipeline)
+func (m *MaterialModel) GetOne(ctx context.Context, id string) (*Material, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	materials, err := m.find(ctx, bson.M{"id": id})
 	if err != nil {
 		return nil, err
 	}
-
-	var results []bson.M
-	if err := cursor.All(ctx, &results); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			log.Println("Object not found")
-			return nil, nil
-		} else {
-			log.Fatal(err)
-			return nil, err
-		}
-	}
-
-	if len(results) > 0 {
-		materialBytes, err := json.Marshal(results[0]["materials"])
-		if err != nil {
-			return nil, err
-		}
-
-		var myMaterial Material
-		err = json.Unmarshal(materialBytes, &myMaterial)
-		if err != nil {
-			return nil, err
-		}
-
-		return &myMaterial, nil
+	if len(materials) > 0 {
+		return &materials[0], nil
 	}
 
-	return nil, fmt.Errorf("material with ID %v not found", id)
+	return nil, fmt.Errorf("material with ID %v %w", id, ErrNotFound)
 }
 
-func (m *MaterialModel) GetBySupplier(supplierID string) (*[]Material, error) {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (m *MaterialModel) GetBySupplier(ctx context.Context, supplierID string) (*[]Material, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	pipeline := bson.A{
-		bson.D{
-			{"$match", bson.D{{"name", companyFirstLMaiusc}}},
-		},
-		bson.D{
-			{"$unwind", "$materials"},
-		},
-		bson.D{
-			{"$match", bson.D{{"materials.supplier.id", supplierID}}},
-		},
-	}
-
-	cursor, err := m.COLLECTION.Aggregate(ctx, pipeline)
+	materials, err := m.find(ctx, bson.M{"supplier.id": supplierID})
 	if err != nil {
 		return nil, err
 	}
-
-	var results []bson.M
-	if err := cursor.All(ctx, &results); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			log.Println("Object not found")
-			return nil, nil
-		} else {
-			log.Fatal(err)
-			return nil, err
-		}
-	}
-
-	if len(results) > 0 {
-		var myMaterials []Material
-		for _, material := range results {
-			var mat Material
-			materialBytes, err := json.Marshal(material["materials"])
-			if err != nil {
-				return nil, err
-			}
-			err = json.Unmarshal(materialBytes, &mat)
-			if err != nil {
-				return nil, err
-			}
-			myMaterials = append(myMaterials, mat)
-		}
-
-		return &myMaterials, nil
+	if len(materials) > 0 {
+		return &materials, nil
 	}
 
-	return nil, fmt.Errorf("materials for supplier with ID %v not found", supplierID)
+	return nil, fmt.Errorf("materials for supplier with ID %v %w", supplierID, ErrNotFound)
 }
 
-func (m *MaterialModel) DeleteOne(id string) error {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (m *MaterialModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	material, err := m.GetOne(id)
+	companyID, err := mongoCompanyID(ctx)
 	if err != nil {
 		return err
 	}
 
-	if material != nil {
-		filter := bson.D{{"name", companyFirstLMaiusc}}
-		update := bson.D{
-			{"$pull", bson.D{
-				{"materials", bson.D{{"id", id}}},
-			}},
-		}
-
-		res, err := m.COLLECTION.UpdateOne(ctx, filter, update)
-		if err != nil {
-			return err
-		}
-		if res.MatchedCount != 0 {
-			log.Printf("matched and deleted material %v", id)
-			return nil
-		}
+	res, err := m.COLLECTION.DeleteOne(ctx, bson.M{"company_id": companyID, "id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount != 0 {
+		log.Printf("matched and deleted material %v", id)
+		return nil
 	}
 
-	return errors.New("something went wrong")
+	return fmt.Errorf("material with ID %v %w", id, ErrNotFound)
 }
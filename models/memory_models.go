@@ -0,0 +1,1126 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps every company, with all of its records, in process memory,
+// companies are keyed by ID
+type MemoryStore struct {
+	mu        sync.RWMutex
+	mode      ReferenceMode
+	companies map[string]*Company
+	keys      []APIKey
+	users     []User
+	sessions  []Session
+	audit     []AuditEntry
+	trash     []TrashItem
+}
+
+func NewMemoryStore(mode ReferenceMode) *MemoryStore {
+	return &MemoryStore{mode: mode, companies: map[string]*Company{}}
+}
+
+func NewMemoryRepositories(mode ReferenceMode) *Repositories {
+	store := NewMemoryStore(mode)
+	return withAudit(withTrash(&Repositories{
+		Products:  &MemoryProductModel{Store: store},
+		Materials: &MemoryMaterialModel{Store: store},
+		Suppliers: &MemorySupplierModel{Store: store},
+		Certs:     &MemoryCertModel{Store: store},
+		Lots:      &MemoryLotModel{Store: store},
+		Company:   &MemoryCompanyModel{Store: store},
+		APIKeys:   &MemoryAPIKeyModel{Store: store},
+		Users:     &MemoryUserModel{Store: store},
+		Sessions:  &MemorySessionModel{Store: store},
+		Audit:     &MemoryAuditModel{Store: store},
+		Trash:     &MemoryTrashModel{Store: store},
+	}))
+}
+
+// company returns the document of the company ctx is scoped to, callers must
+// hold the lock
+func (s *MemoryStore) company(ctx context.Context) *Company {
+	companyID, ok := CompanyFrom(ctx)
+	if !ok {
+		return nil
+	}
+	return s.companies[companyID]
+}
+
+// current is company for the methods that fail without one, like the other
+// backends: ErrNoCompany when ctx has none, ErrNotFound when it does not exist
+func (s *MemoryStore) current(ctx context.Context) (*Company, error) {
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	company := s.companies[companyID]
+	if company == nil {
+		return nil, fmt.Errorf("company with ID %v %w", companyID, ErrNotFound)
+	}
+	return company, nil
+}
+
+func cloneProduct(product Product) Product {
+	product.Materials = append([]Material(nil), product.Materials...)
+	product.BOM = append([]BOMLine(nil), product.BOM...)
+	product.Costs = append([]CostLine(nil), product.Costs...)
+	product.Lots = append([]string(nil), product.Lots...)
+	return product
+}
+
+// resolveMaterial replaces the supplier reference of material with the stored
+// supplier, callers must hold the lock
+func (s *MemoryStore) resolveMaterial(company *Company, material Material) Material {
+	if s.mode == ReferenceEmbedded {
+		return material
+	}
+	for _, supplier := range company.Suppliers {
+		if supplier.Id == material.Supplier.Id {
+			material.Supplier = supplier
+			break
+		}
+	}
+	return material
+}
+
+// resolveProduct replaces the material references of product with the stored
+// materials, callers must hold the lock
+func (s *MemoryStore) resolveProduct(company *Company, product Product) Product {
+	product = cloneProduct(product)
+	if s.mode == ReferenceEmbedded {
+		return product
+	}
+	for i, ref := range product.Materials {
+		for _, material := range company.Materials {
+			if material.Id == ref.Id {
+				product.Materials[i] = s.resolveMaterial(company, material)
+				break
+			}
+		}
+	}
+	return product
+}
+
+// propagateMaterial replaces the copies of material embedded in products,
+// callers must hold the lock
+func (s *MemoryStore) propagateMaterial(company *Company, material Material) {
+	for i := range company.Products {
+		for j := range company.Products[i].Materials {
+			if company.Products[i].Materials[j].Id == material.Id {
+				company.Products[i].Materials[j] = material
+			}
+		}
+	}
+}
+
+// propagateSupplier replaces the copies of supplier embedded in materials and
+// in the materials of products, callers must hold the lock
+func (s *MemoryStore) propagateSupplier(company *Company, supplier Supplier) {
+	for i := range company.Materials {
+		if company.Materials[i].Supplier.Id == supplier.Id {
+			company.Materials[i].Supplier = supplier
+		}
+	}
+	for i := range company.Products {
+		for j := range company.Products[i].Materials {
+			if company.Products[i].Materials[j].Supplier.Id == supplier.Id {
+				company.Products[i].Materials[j].Supplier = supplier
+			}
+		}
+	}
+}
+
+type MemoryProductModel struct {
+	Store *MemoryStore
+}
+
+// MemoryProductModel methods
+func (p *MemoryProductModel) Add(ctx context.Context, product Product) error {
+	p.Store.mu.Lock()
+	defer p.Store.mu.Unlock()
+
+	company, err := p.Store.current(ctx)
+	if err != nil {
+		return err
+	}
+	company.Products = append(company.Products, cloneProduct(storedProduct(product, p.Store.mode)))
+	return nil
+}
+
+func (p *MemoryProductModel) Update(ctx context.Context, product Product) error {
+	p.Store.mu.Lock()
+	defer p.Store.mu.Unlock()
+
+	if company := p.Store.company(ctx); company != nil {
+		for i := range company.Products {
+			if company.Products[i].Id == product.Id {
+				if company.Products[i].Version != product.Version {
+					return fmt.Errorf("product %v %w", product.Id, ErrStale)
+				}
+				product.Version++
+				company.Products[i] = cloneProduct(storedProduct(product, p.Store.mode))
+				log.Printf("matched and replaced product %v", product.Id)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("product %w", ErrNotFound)
+}
+
+func (p *MemoryProductModel) GetAll(ctx context.Context) ([]Product, error) {
+	p.Store.mu.RLock()
+	defer p.Store.mu.RUnlock()
+
+	company, err := p.Store.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	products := make([]Product, 0, len(company.Products))
+	for _, product := range company.Products {
+		products = append(products, p.Store.resolveProduct(company, product))
+	}
+	return products, nil
+}
+
+func (p *MemoryProductModel) GetOne(ctx context.Context, id string) (*Product, error) {
+	p.Store.mu.RLock()
+	defer p.Store.mu.RUnlock()
+
+	if company := p.Store.company(ctx); company != nil {
+		for _, product := range company.Products {
+			if product.Id == id {
+				myProduct := p.Store.resolveProduct(company, product)
+				return &myProduct, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("product with ID %v %w", id, ErrNotFound)
+}
+
+func (p *MemoryProductModel) GetByMaterial(ctx context.Context, materialID string) (*[]Product, error) {
+	p.Store.mu.RLock()
+	defer p.Store.mu.RUnlock()
+
+	var myProducts []Product
+	if company := p.Store.company(ctx); company != nil {
+		for _, product := range company.Products {
+			for _, material := range product.Materials {
+				if material.Id == materialID {
+					myProducts = append(myProducts, p.Store.resolveProduct(company, product))
+					break
+				}
+			}
+		}
+	}
+	if len(myProducts) > 0 {
+		return &myProducts, nil
+	}
+	return nil, fmt.Errorf("products with material with ID %v %w", materialID, ErrNotFound)
+}
+
+func (p *MemoryProductModel) GetByLot(ctx context.Context, lotID string) ([]Product, error) {
+	p.Store.mu.RLock()
+	defer p.Store.mu.RUnlock()
+
+	myProducts := []Product{}
+	if company := p.Store.company(ctx); company != nil {
+		for _, product := range company.Products {
+			for _, id := range product.Lots {
+				if id == lotID {
+					myProducts = append(myProducts, p.Store.resolveProduct(company, product))
+					break
+				}
+			}
+		}
+	}
+	return myProducts, nil
+}
+
+func (p *MemoryProductModel) DeleteOne(ctx context.Context, id string) error {
+	p.Store.mu.Lock()
+	defer p.Store.mu.Unlock()
+
+	if company := p.Store.company(ctx); company != nil {
+		for i, product := range company.Products {
+			if product.Id == id {
+				company.Products = append(company.Products[:i], company.Products[i+1:]...)
+				log.Printf("matched and deleted product %v", id)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("product with ID %v %w", id, ErrNotFound)
+}
+
+type MemoryMaterialModel struct {
+	Store *MemoryStore
+}
+
+// MemoryMaterialModel methods
+func (m *MemoryMaterialModel) Add(ctx context.Context, material Material) error {
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	company, err := m.Store.current(ctx)
+	if err != nil {
+		return err
+	}
+	company.Materials = append(company.Materials, storedMaterial(material, m.Store.mode))
+	return nil
+}
+
+func (m *MemoryMaterialModel) Update(ctx context.Context, material Material) error {
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if company := m.Store.company(ctx); company != nil {
+		for i := range company.Materials {
+			if company.Materials[i].Id == material.Id {
+				if company.Materials[i].Version != material.Version {
+					return fmt.Errorf("material %v %w", material.Id, ErrStale)
+				}
+				material.Version++
+				company.Materials[i] = storedMaterial(material, m.Store.mode)
+				log.Printf("matched and replaced material %v", material.Id)
+				if m.Store.mode == ReferenceEmbedded {
+					m.Store.propagateMaterial(company, company.Materials[i])
+				}
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("material %w", ErrNotFound)
+}
+
+func (m *MemoryMaterialModel) GetAll(ctx context.Context) ([]Material, error) {
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	company, err := m.Store.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	materials := make([]Material, 0, len(company.Materials))
+	for _, material := range company.Materials {
+		materials = append(materials, m.Store.resolveMaterial(company, material))
+	}
+	return materials, nil
+}
+
+func (m *MemoryMaterialModel) GetOne(ctx context.Context, id string) (*Material, error) {
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	if company := m.Store.company(ctx); company != nil {
+		for _, material := range company.Materials {
+			if material.Id == id {
+				myMaterial := m.Store.resolveMaterial(company, material)
+				return &myMaterial, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("material with ID %v %w", id, ErrNotFound)
+}
+
+func (m *MemoryMaterialModel) GetBySupplier(ctx context.Context, supplierID string) (*[]Material, error) {
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	var myMaterials []Material
+	if company := m.Store.company(ctx); company != nil {
+		for _, material := range company.Materials {
+			if material.Supplier.Id == supplierID {
+				myMaterials = append(myMaterials, m.Store.resolveMaterial(company, material))
+			}
+		}
+	}
+	if len(myMaterials) > 0 {
+		return &myMaterials, nil
+	}
+	return nil, fmt.Errorf("materials for supplier with ID %v %w", supplierID, ErrNotFound)
+}
+
+func (m *MemoryMaterialModel) DeleteOne(ctx context.Context, id string) error {
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if company := m.Store.company(ctx); company != nil {
+		for i, material := range company.Materials {
+			if material.Id == id {
+				company.Materials = append(company.Materials[:i], company.Materials[i+1:]...)
+				log.Printf("matched and deleted material %v", id)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("material with ID %v %w", id, ErrNotFound)
+}
+
+type MemorySupplierModel struct {
+	Store *MemoryStore
+}
+
+// MemorySupplierModel methods
+func (s *MemorySupplierModel) Add(ctx context.Context, supplier Supplier) error {
+	s.Store.mu.Lock()
+	defer s.Store.mu.Unlock()
+
+	company, err := s.Store.current(ctx)
+	if err != nil {
+		return err
+	}
+	company.Suppliers = append(company.Suppliers, supplier)
+	return nil
+}
+
+func (s *MemorySupplierModel) Update(ctx context.Context, supplier Supplier) error {
+	s.Store.mu.Lock()
+	defer s.Store.mu.Unlock()
+
+	if company := s.Store.company(ctx); company != nil {
+		for i := range company.Suppliers {
+			if company.Suppliers[i].Id == supplier.Id {
+				if company.Suppliers[i].Version != supplier.Version {
+					return fmt.Errorf("supplier %v %w", supplier.Id, ErrStale)
+				}
+				supplier.Version++
+				company.Suppliers[i] = supplier
+				log.Printf("matched and replaced supplier %v", supplier.Id)
+				if s.Store.mode == ReferenceEmbedded {
+					s.Store.propagateSupplier(company, supplier)
+				}
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("supplier %w", ErrNotFound)
+}
+
+func (s *MemorySupplierModel) GetAll(ctx context.Context) ([]Supplier, error) {
+	s.Store.mu.RLock()
+	defer s.Store.mu.RUnlock()
+
+	company, err := s.Store.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append([]Supplier{}, company.Suppliers...), nil
+}
+
+func (s *MemorySupplierModel) GetOne(ctx context.Context, id string) (*Supplier, error) {
+	s.Store.mu.RLock()
+	defer s.Store.mu.RUnlock()
+
+	if company := s.Store.company(ctx); company != nil {
+		for _, supplier := range company.Suppliers {
+			if supplier.Id == id {
+				mySupplier := supplier
+				return &mySupplier, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("supplier with ID %v %w", id, ErrNotFound)
+}
+
+func (s *MemorySupplierModel) DeleteOne(ctx context.Context, id string) error {
+	s.Store.mu.Lock()
+	defer s.Store.mu.Unlock()
+
+	if company := s.Store.company(ctx); company != nil {
+		for i, supplier := range company.Suppliers {
+			if supplier.Id == id {
+				company.Suppliers = append(company.Suppliers[:i], company.Suppliers[i+1:]...)
+				log.Printf("matched and deleted supplier %v", id)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("supplier with ID %v %w", id, ErrNotFound)
+}
+
+type MemoryCertModel struct {
+	Store *MemoryStore
+}
+
+// MemoryCertModel methods
+func (c *MemoryCertModel) Add(ctx context.Context, cert Cert) error {
+	c.Store.mu.Lock()
+	defer c.Store.mu.Unlock()
+
+	company, err := c.Store.current(ctx)
+	if err != nil {
+		return err
+	}
+	company.Certs = append(company.Certs, cert)
+	return nil
+}
+
+func (c *MemoryCertModel) Update(ctx context.Context, cert Cert) error {
+	c.Store.mu.Lock()
+	defer c.Store.mu.Unlock()
+
+	if company := c.Store.company(ctx); company != nil {
+		for i := range company.Certs {
+			if company.Certs[i].Id == cert.Id {
+				if company.Certs[i].Version != cert.Version {
+					return fmt.Errorf("certification %v %w", cert.Id, ErrStale)
+				}
+				cert.Version++
+				company.Certs[i] = cert
+				log.Printf("matched and replaced certification %v", cert.Id)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("certification %w", ErrNotFound)
+}
+
+func (c *MemoryCertModel) GetAll(ctx context.Context) ([]Cert, error) {
+	c.Store.mu.RLock()
+	defer c.Store.mu.RUnlock()
+
+	company, err := c.Store.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append([]Cert{}, company.Certs...), nil
+}
+
+func (c *MemoryCertModel) GetOne(ctx context.Context, id string) (*Cert, error) {
+	c.Store.mu.RLock()
+	defer c.Store.mu.RUnlock()
+
+	if company := c.Store.company(ctx); company != nil {
+		for _, cert := range company.Certs {
+			if cert.Id == id {
+				myCert := cert
+				return &myCert, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("certification with ID %v %w", id, ErrNotFound)
+}
+
+func (c *MemoryCertModel) GetBySubject(ctx context.Context, subjectID string) (*[]Cert, error) {
+	c.Store.mu.RLock()
+	defer c.Store.mu.RUnlock()
+
+	var myCerts []Cert
+	if company := c.Store.company(ctx); company != nil {
+		for _, cert := range company.Certs {
+			if cert.Subject.Id == subjectID {
+				myCerts = append(myCerts, cert)
+			}
+		}
+	}
+	if len(myCerts) > 0 {
+		return &myCerts, nil
+	}
+	return nil, fmt.Errorf("certifications for subject with ID %v %w", subjectID, ErrNotFound)
+}
+
+func (c *MemoryCertModel) DeleteOne(ctx context.Context, id string) error {
+	c.Store.mu.Lock()
+	defer c.Store.mu.Unlock()
+
+	if company := c.Store.company(ctx); company != nil {
+		for i, cert := range company.Certs {
+			if cert.Id == id {
+				company.Certs = append(company.Certs[:i], company.Certs[i+1:]...)
+				log.Printf("matched and deleted certification %v", id)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("certification with ID %v %w", id, ErrNotFound)
+}
+
+type MemoryLotModel struct {
+	Store *MemoryStore
+}
+
+// MemoryLotModel methods
+func (l *MemoryLotModel) Add(ctx context.Context, lot Lot) error {
+	l.Store.mu.Lock()
+	defer l.Store.mu.Unlock()
+
+	company, err := l.Store.current(ctx)
+	if err != nil {
+		return err
+	}
+	company.Lots = append(company.Lots, lot)
+	return nil
+}
+
+func (l *MemoryLotModel) Update(ctx context.Context, lot Lot) error {
+	l.Store.mu.Lock()
+	defer l.Store.mu.Unlock()
+
+	if company := l.Store.company(ctx); company != nil {
+		for i := range company.Lots {
+			if company.Lots[i].Id == lot.Id {
+				if company.Lots[i].Version != lot.Version {
+					return fmt.Errorf("lot %v %w", lot.Id, ErrStale)
+				}
+				lot.Version++
+				company.Lots[i] = lot
+				log.Printf("matched and replaced lot %v", lot.Id)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("lot %w", ErrNotFound)
+}
+
+func (l *MemoryLotModel) GetAll(ctx context.Context) ([]Lot, error) {
+	l.Store.mu.RLock()
+	defer l.Store.mu.RUnlock()
+
+	company, err := l.Store.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append([]Lot{}, company.Lots...), nil
+}
+
+func (l *MemoryLotModel) GetOne(ctx context.Context, id string) (*Lot, error) {
+	l.Store.mu.RLock()
+	defer l.Store.mu.RUnlock()
+
+	if company := l.Store.company(ctx); company != nil {
+		for _, lot := range company.Lots {
+			if lot.Id == id {
+				myLot := lot
+				return &myLot, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("lot with ID %v %w", id, ErrNotFound)
+}
+
+func (l *MemoryLotModel) GetByMaterial(ctx context.Context, materialID string) ([]Lot, error) {
+	l.Store.mu.RLock()
+	defer l.Store.mu.RUnlock()
+
+	myLots := []Lot{}
+	if company := l.Store.company(ctx); company != nil {
+		for _, lot := range company.Lots {
+			if lot.MaterialID == materialID {
+				myLots = append(myLots, lot)
+			}
+		}
+	}
+	return myLots, nil
+}
+
+func (l *MemoryLotModel) DeleteOne(ctx context.Context, id string) error {
+	l.Store.mu.Lock()
+	defer l.Store.mu.Unlock()
+
+	if company := l.Store.company(ctx); company != nil {
+		for i, lot := range company.Lots {
+			if lot.Id == id {
+				company.Lots = append(company.Lots[:i], company.Lots[i+1:]...)
+				log.Printf("matched and deleted lot %v", id)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("lot with ID %v %w", id, ErrNotFound)
+}
+
+type MemoryCompanyModel struct {
+	Store *MemoryStore
+}
+
+// MemoryCompanyModel methods
+func (c *MemoryCompanyModel) Initialize(ctx context.Context, company Company) error {
+	c.Store.mu.Lock()
+	defer c.Store.mu.Unlock()
+
+	if c.Store.named(company.Name) != nil {
+		return fmt.Errorf("company %v %w", company.Name, ErrDuplicate)
+	}
+
+	c.Store.companies[company.ID.Hex()] = &Company{ID: company.ID, Name: company.Name}
+
+	log.Printf("Created new company with ID %v\n", company.ID)
+	return nil
+}
+
+// named returns the company called name, callers must hold the lock
+func (s *MemoryStore) named(name string) *Company {
+	for _, company := range s.companies {
+		if company.Name == name {
+			return company
+		}
+	}
+	return nil
+}
+
+func (c *MemoryCompanyModel) GetAll(ctx context.Context) ([]Company, error) {
+	c.Store.mu.RLock()
+	defer c.Store.mu.RUnlock()
+
+	companies := make([]Company, 0, len(c.Store.companies))
+	for _, company := range c.Store.companies {
+		companies = append(companies, Company{ID: company.ID, Name: company.Name})
+	}
+	sort.Slice(companies, func(i, j int) bool { return companies[i].ID.Hex() < companies[j].ID.Hex() })
+	return companies, nil
+}
+
+func (c *MemoryCompanyModel) GetOne(ctx context.Context, id string) (*Company, error) {
+	c.Store.mu.RLock()
+	defer c.Store.mu.RUnlock()
+
+	if company, ok := c.Store.companies[id]; ok {
+		return &Company{ID: company.ID, Name: company.Name}, nil
+	}
+	return nil, fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+}
+
+func (c *MemoryCompanyModel) Rename(ctx context.Context, id string, name string) error {
+	c.Store.mu.Lock()
+	defer c.Store.mu.Unlock()
+
+	company, ok := c.Store.companies[id]
+	if !ok {
+		return fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+	}
+	if other := c.Store.named(name); other != nil && other != company {
+		return fmt.Errorf("company %v %w", name, ErrDuplicate)
+	}
+	company.Name = name
+	log.Printf("renamed company %v to %v", id, name)
+	return nil
+}
+
+func (c *MemoryCompanyModel) DeleteOne(ctx context.Context, id string) error {
+	c.Store.mu.Lock()
+	defer c.Store.mu.Unlock()
+
+	if _, ok := c.Store.companies[id]; !ok {
+		return fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+	}
+	delete(c.Store.companies, id)
+	keys := c.Store.keys[:0]
+	for _, key := range c.Store.keys {
+		if key.CompanyID != id {
+			keys = append(keys, key)
+		}
+	}
+	c.Store.keys = keys
+	users := c.Store.users[:0]
+	for _, user := range c.Store.users {
+		if user.CompanyID != id {
+			users = append(users, user)
+		}
+	}
+	c.Store.users = users
+	sessions := c.Store.sessions[:0]
+	for _, session := range c.Store.sessions {
+		if session.CompanyID != id {
+			sessions = append(sessions, session)
+		}
+	}
+	c.Store.sessions = sessions
+	trash := c.Store.trash[:0]
+	for _, item := range c.Store.trash {
+		if item.CompanyID != id {
+			trash = append(trash, item)
+		}
+	}
+	c.Store.trash = trash
+	log.Printf("matched and deleted company %v", id)
+	return nil
+}
+
+type MemoryAPIKeyModel struct {
+	Store *MemoryStore
+}
+
+// MemoryAPIKeyModel methods
+func (k *MemoryAPIKeyModel) Add(ctx context.Context, key APIKey) error {
+	k.Store.mu.Lock()
+	defer k.Store.mu.Unlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+	key.CompanyID = companyID
+	k.Store.keys = append(k.Store.keys, key)
+	return nil
+}
+
+func (k *MemoryAPIKeyModel) GetAll(ctx context.Context) ([]APIKey, error) {
+	k.Store.mu.RLock()
+	defer k.Store.mu.RUnlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := []APIKey{}
+	for _, key := range k.Store.keys {
+		if key.CompanyID == companyID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (k *MemoryAPIKeyModel) FindByHash(ctx context.Context, hash string) (*APIKey, error) {
+	k.Store.mu.RLock()
+	defer k.Store.mu.RUnlock()
+
+	for _, key := range k.Store.keys {
+		if key.Hash == hash {
+			myKey := key
+			return &myKey, nil
+		}
+	}
+	return nil, fmt.Errorf("API key %w", ErrNotFound)
+}
+
+func (k *MemoryAPIKeyModel) Revoke(ctx context.Context, id string) error {
+	k.Store.mu.Lock()
+	defer k.Store.mu.Unlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range k.Store.keys {
+		if k.Store.keys[i].Id == id && k.Store.keys[i].CompanyID == companyID {
+			k.Store.keys[i].Revoked = true
+			log.Printf("revoked API key %v", id)
+			return nil
+		}
+	}
+	return fmt.Errorf("API key with ID %v %w", id, ErrNotFound)
+}
+
+type MemoryUserModel struct {
+	Store *MemoryStore
+}
+
+// MemoryUserModel methods
+func (u *MemoryUserModel) Add(ctx context.Context, user User) error {
+	u.Store.mu.Lock()
+	defer u.Store.mu.Unlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+	for _, other := range u.Store.users {
+		if other.Email == user.Email {
+			return fmt.Errorf("user with email %v %w", user.Email, ErrDuplicate)
+		}
+	}
+	user.CompanyID = companyID
+	u.Store.users = append(u.Store.users, user)
+	return nil
+}
+
+func (u *MemoryUserModel) Update(ctx context.Context, user User) error {
+	u.Store.mu.Lock()
+	defer u.Store.mu.Unlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+	for _, other := range u.Store.users {
+		if other.Email == user.Email && other.Id != user.Id {
+			return fmt.Errorf("user with email %v %w", user.Email, ErrDuplicate)
+		}
+	}
+	for i := range u.Store.users {
+		if u.Store.users[i].Id == user.Id && u.Store.users[i].CompanyID == companyID {
+			user.CompanyID = companyID
+			u.Store.users[i] = user
+			log.Printf("matched and replaced user %v", user.Id)
+			return nil
+		}
+	}
+	return fmt.Errorf("user %w", ErrNotFound)
+}
+
+func (u *MemoryUserModel) GetAll(ctx context.Context) ([]User, error) {
+	u.Store.mu.RLock()
+	defer u.Store.mu.RUnlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users := []User{}
+	for _, user := range u.Store.users {
+		if user.CompanyID == companyID {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (u *MemoryUserModel) GetOne(ctx context.Context, id string) (*User, error) {
+	u.Store.mu.RLock()
+	defer u.Store.mu.RUnlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range u.Store.users {
+		if user.Id == id && user.CompanyID == companyID {
+			myUser := user
+			return &myUser, nil
+		}
+	}
+	return nil, fmt.Errorf("user with ID %v %w", id, ErrNotFound)
+}
+
+func (u *MemoryUserModel) FindByEmail(ctx context.Context, email string) (*User, error) {
+	u.Store.mu.RLock()
+	defer u.Store.mu.RUnlock()
+
+	for _, user := range u.Store.users {
+		if user.Email == email {
+			myUser := user
+			return &myUser, nil
+		}
+	}
+	return nil, fmt.Errorf("user with email %v %w", email, ErrNotFound)
+}
+
+func (u *MemoryUserModel) DeleteOne(ctx context.Context, id string) error {
+	u.Store.mu.Lock()
+	defer u.Store.mu.Unlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+	for i, user := range u.Store.users {
+		if user.Id == id && user.CompanyID == companyID {
+			u.Store.users = append(u.Store.users[:i], u.Store.users[i+1:]...)
+			sessions := u.Store.sessions[:0]
+			for _, session := range u.Store.sessions {
+				if session.UserID != id {
+					sessions = append(sessions, session)
+				}
+			}
+			u.Store.sessions = sessions
+			log.Printf("matched and deleted user %v", id)
+			return nil
+		}
+	}
+	return fmt.Errorf("user with ID %v %w", id, ErrNotFound)
+}
+
+type MemorySessionModel struct {
+	Store *MemoryStore
+}
+
+// MemorySessionModel methods
+func (s *MemorySessionModel) Add(ctx context.Context, session Session) error {
+	s.Store.mu.Lock()
+	defer s.Store.mu.Unlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+	session.CompanyID = companyID
+	s.Store.sessions = append(s.Store.sessions, session)
+	return nil
+}
+
+func (s *MemorySessionModel) GetOne(ctx context.Context, id string) (*Session, error) {
+	s.Store.mu.RLock()
+	defer s.Store.mu.RUnlock()
+
+	for _, session := range s.Store.sessions {
+		if session.Id == id {
+			mySession := session
+			return &mySession, nil
+		}
+	}
+	return nil, fmt.Errorf("session with ID %v %w", id, ErrNotFound)
+}
+
+func (s *MemorySessionModel) Revoke(ctx context.Context, id string) error {
+	s.Store.mu.Lock()
+	defer s.Store.mu.Unlock()
+
+	for i := range s.Store.sessions {
+		if s.Store.sessions[i].Id == id {
+			s.Store.sessions[i].Revoked = true
+			log.Printf("revoked session %v", id)
+			return nil
+		}
+	}
+	return fmt.Errorf("session with ID %v %w", id, ErrNotFound)
+}
+
+func (s *MemorySessionModel) RevokeByUser(ctx context.Context, userID string, except string) error {
+	s.Store.mu.Lock()
+	defer s.Store.mu.Unlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+	revoked := 0
+	for i, session := range s.Store.sessions {
+		if session.UserID == userID && session.CompanyID == companyID && session.Id != except && !session.Revoked {
+			s.Store.sessions[i].Revoked = true
+			revoked++
+		}
+	}
+	log.Printf("revoked %d sessions of user %v", revoked, userID)
+	return nil
+}
+
+type MemoryAuditModel struct {
+	Store *MemoryStore
+}
+
+// MemoryAuditModel methods
+func (a *MemoryAuditModel) Add(ctx context.Context, entry AuditEntry) error {
+	a.Store.mu.Lock()
+	defer a.Store.mu.Unlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+	entry.CompanyID = companyID
+	a.Store.audit = append(a.Store.audit, entry)
+	return nil
+}
+
+func (a *MemoryAuditModel) GetByEntity(ctx context.Context, entityID string) ([]AuditEntry, error) {
+	a.Store.mu.RLock()
+	defer a.Store.mu.RUnlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := []AuditEntry{}
+	for _, entry := range a.Store.audit {
+		if entry.CompanyID == companyID && entry.EntityID == entityID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+type MemoryTrashModel struct {
+	Store *MemoryStore
+}
+
+// MemoryTrashModel methods
+func (t *MemoryTrashModel) Add(ctx context.Context, item TrashItem) error {
+	t.Store.mu.Lock()
+	defer t.Store.mu.Unlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+	item.CompanyID = companyID
+	t.Store.trash = append(t.Store.trash, item)
+	return nil
+}
+
+func (t *MemoryTrashModel) GetAll(ctx context.Context) ([]TrashItem, error) {
+	t.Store.mu.RLock()
+	defer t.Store.mu.RUnlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items := []TrashItem{}
+	for _, item := range t.Store.trash {
+		if item.CompanyID == companyID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (t *MemoryTrashModel) GetOne(ctx context.Context, entityID string) (*TrashItem, error) {
+	t.Store.mu.RLock()
+	defer t.Store.mu.RUnlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range t.Store.trash {
+		if item.CompanyID == companyID && item.EntityID == entityID {
+			myItem := item
+			return &myItem, nil
+		}
+	}
+	return nil, fmt.Errorf("trash item with ID %v %w", entityID, ErrNotFound)
+}
+
+func (t *MemoryTrashModel) DeleteOne(ctx context.Context, entityID string) error {
+	t.Store.mu.Lock()
+	defer t.Store.mu.Unlock()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+	for i, item := range t.Store.trash {
+		if item.CompanyID == companyID && item.EntityID == entityID {
+			t.Store.trash = append(t.Store.trash[:i], t.Store.trash[i+1:]...)
+			log.Printf("purged %v from the trash", entityID)
+			return nil
+		}
+	}
+	return fmt.Errorf("trash item with ID %v %w", entityID, ErrNotFound)
+}
+
+func (t *MemoryTrashModel) PurgeBefore(ctx context.Context, before string) (int64, error) {
+	t.Store.mu.Lock()
+	defer t.Store.mu.Unlock()
+
+	kept := t.Store.trash[:0]
+	for _, item := range t.Store.trash {
+		if item.DeletedAt >= before {
+			kept = append(kept, item)
+		}
+	}
+	purged := int64(len(t.Store.trash) - len(kept))
+	t.Store.trash = kept
+	return purged, nil
+}
+
+var (
+	_ ProductRepository  = (*MemoryProductModel)(nil)
+	_ MaterialRepository = (*MemoryMaterialModel)(nil)
+	_ SupplierRepository = (*MemorySupplierModel)(nil)
+	_ CertRepository     = (*MemoryCertModel)(nil)
+	_ LotRepository      = (*MemoryLotModel)(nil)
+	_ CompanyRepository  = (*MemoryCompanyModel)(nil)
+	_ APIKeyRepository   = (*MemoryAPIKeyModel)(nil)
+	_ UserRepository     = (*MemoryUserModel)(nil)
+	_ SessionRepository  = (*MemorySessionModel)(nil)
+	_ AuditRepository    = (*MemoryAuditModel)(nil)
+	_ TrashRepository    = (*MemoryTrashModel)(nil)
+)
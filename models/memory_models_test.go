@@ -0,0 +1,10 @@
+package models_test
+
+import (
+	"marvinhagler/models"
+	"testing"
+)
+
+func TestMemoryNoCompany(t *testing.T) {
+	testNoCompany(t, models.NewMemoryRepositories(models.ReferenceByID))
+}
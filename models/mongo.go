@@ -0,0 +1,293 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"time"
+)
+
+// On MongoDB the company documents stay in the collection declared in
+// COLLECTION_NAME, every other entity has its own collection in the same
+// database and each document carries the company_id it belongs to.
+const (
+	productsCollection  = "products"
+	materialsCollection = "materials"
+	suppliersCollection = "suppliers"
+	certsCollection     = "certs"
+	lotsCollection      = "lots"
+	apiKeysCollection   = "api_keys"
+	usersCollection     = "users"
+	sessionsCollection  = "sessions"
+	auditCollection     = "audit"
+	trashCollection     = "trash"
+)
+
+func NewMongoRepositories(companies *mongo.Collection, mode ReferenceMode) *Repositories {
+	database := companies.Database()
+	return withAudit(withTrash(&Repositories{
+		Products:  &ProductModel{COLLECTION: database.Collection(productsCollection), REFERENCES: mode},
+		Materials: &MaterialModel{COLLECTION: database.Collection(materialsCollection), REFERENCES: mode},
+		Suppliers: &SupplierModel{COLLECTION: database.Collection(suppliersCollection), REFERENCES: mode},
+		Certs:     &CertModel{COLLECTION: database.Collection(certsCollection)},
+		Lots:      &LotModel{COLLECTION: database.Collection(lotsCollection)},
+		Company:   &CompanyModel{COLLECTION: companies},
+		APIKeys:   &APIKeyModel{COLLECTION: database.Collection(apiKeysCollection)},
+		Users:     &UserModel{COLLECTION: database.Collection(usersCollection)},
+		Sessions:  &SessionModel{COLLECTION: database.Collection(sessionsCollection)},
+		Audit:     &AuditModel{COLLECTION: database.Collection(auditCollection)},
+		Trash:     &TrashModel{COLLECTION: database.Collection(trashCollection)},
+	}))
+}
+
+// mongoCompanyID returns the _id of the company ctx is scoped to
+func mongoCompanyID(ctx context.Context) (primitive.ObjectID, error) {
+	id, err := currentCompany(ctx)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+	}
+	return objectID, nil
+}
+
+// EnsureMongoIndexes creates the indexes used to look records up by ID and to
+// follow the references between them
+func EnsureMongoIndexes(companies *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	database := companies.Database()
+	indexes := map[string][]mongo.IndexModel{
+		productsCollection: {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "materials.id", Value: 1}}},
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "lots", Value: 1}}},
+		},
+		materialsCollection: {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "supplier.id", Value: 1}}},
+		},
+		suppliersCollection: {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		certsCollection: {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "subject.id", Value: 1}}},
+		},
+		lotsCollection: {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "materialId", Value: 1}}},
+		},
+		apiKeysCollection: {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		usersCollection: {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		sessionsCollection: {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "userId", Value: 1}}},
+		},
+		auditCollection: {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "entityId", Value: 1}}},
+		},
+		trashCollection: {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "entityId", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "deletedAt", Value: 1}}},
+		},
+	}
+
+	for name, models := range indexes {
+		if _, err := database.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("failed to create indexes on %v: %v", name, err)
+		}
+	}
+
+	// older versions could initialize the same company twice, keep serving
+	// them and only warn until the duplicates are removed
+	unique := mongo.IndexModel{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)}
+	if _, err := companies.Indexes().CreateOne(ctx, unique); err != nil {
+		log.Printf("Company names are not unique, delete the duplicates to enforce it: %v", err)
+	}
+	return nil
+}
+
+// MigrateEmbeddedMongo moves the products, materials, suppliers and certs
+// arrays embedded in the company documents to their own collections and then
+// removes the arrays. Records are upserted by ID, so running it again after a
+// partial failure is safe.
+func MigrateEmbeddedMongo(companies *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	database := companies.Database()
+	filter := bson.M{"$or": bson.A{
+		bson.M{"products": bson.M{"$exists": true}},
+		bson.M{"materials": bson.M{"$exists": true}},
+		bson.M{"suppliers": bson.M{"$exists": true}},
+		bson.M{"certs": bson.M{"$exists": true}},
+	}}
+
+	cursor, err := companies.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var company Company
+		if err := cursor.Decode(&company); err != nil {
+			return err
+		}
+
+		moved := 0
+		upsert := func(collection string, id string, document interface{}) error {
+			_, err := database.Collection(collection).ReplaceOne(ctx,
+				bson.M{"company_id": company.ID, "id": id}, document, options.Replace().SetUpsert(true))
+			moved++
+			return err
+		}
+		for _, product := range company.Products {
+			if err := upsert(productsCollection, product.Id, productDocument{company.ID, product}); err != nil {
+				return err
+			}
+		}
+		for _, material := range company.Materials {
+			if err := upsert(materialsCollection, material.Id, materialDocument{company.ID, material}); err != nil {
+				return err
+			}
+		}
+		for _, supplier := range company.Suppliers {
+			if err := upsert(suppliersCollection, supplier.Id, supplierDocument{company.ID, supplier}); err != nil {
+				return err
+			}
+		}
+		for _, cert := range company.Certs {
+			if err := upsert(certsCollection, cert.Id, certDocument{company.ID, cert}); err != nil {
+				return err
+			}
+		}
+
+		update := bson.M{"$unset": bson.M{"products": "", "materials": "", "suppliers": "", "certs": ""}}
+		if _, err := companies.UpdateByID(ctx, company.ID, update); err != nil {
+			return err
+		}
+		log.Printf("Moved %d embedded records of company %v to their own collections\n", moved, company.Name)
+	}
+	return cursor.Err()
+}
+
+// resolveMongoProducts replaces the material references of products with the
+// stored materials of the company
+func resolveMongoProducts(ctx context.Context, database *mongo.Database, companyID primitive.ObjectID, products []Product) error {
+	var ids []string
+	for _, product := range products {
+		for _, material := range product.Materials {
+			ids = append(ids, material.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var documents []materialDocument
+	filter := bson.M{"company_id": companyID, "id": bson.M{"$in": ids}}
+	if err := findAll(ctx, database.Collection(materialsCollection), filter, &documents); err != nil {
+		return err
+	}
+	materials := make([]Material, 0, len(documents))
+	for _, document := range documents {
+		materials = append(materials, document.Material)
+	}
+	if err := resolveMongoMaterials(ctx, database, companyID, materials); err != nil {
+		return err
+	}
+
+	byID := map[string]Material{}
+	for _, material := range materials {
+		byID[material.Id] = material
+	}
+	for _, product := range products {
+		for i, ref := range product.Materials {
+			if material, ok := byID[ref.Id]; ok {
+				product.Materials[i] = material
+			}
+		}
+	}
+	return nil
+}
+
+// resolveMongoMaterials replaces the supplier references of materials with the
+// stored suppliers of the company
+func resolveMongoMaterials(ctx context.Context, database *mongo.Database, companyID primitive.ObjectID, materials []Material) error {
+	var ids []string
+	for _, material := range materials {
+		if material.Supplier.Id != "" {
+			ids = append(ids, material.Supplier.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var documents []supplierDocument
+	filter := bson.M{"company_id": companyID, "id": bson.M{"$in": ids}}
+	if err := findAll(ctx, database.Collection(suppliersCollection), filter, &documents); err != nil {
+		return err
+	}
+
+	byID := map[string]Supplier{}
+	for _, document := range documents {
+		byID[document.Id] = document.Supplier
+	}
+	for i := range materials {
+		if supplier, ok := byID[materials[i].Supplier.Id]; ok {
+			materials[i].Supplier = supplier
+		}
+	}
+	return nil
+}
+
+// findAll decodes every document matched by filter into out, in insertion order
+func findAll(ctx context.Context, collection *mongo.Collection, filter bson.M, out interface{}) error {
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, out)
+}
+
+// versionFilter matches documents at version, documents stored before
+// versions existed have no version field and count as version 0
+func versionFilter(version int) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
+// staleOrMissing explains why an update matching on version found nothing
+func staleOrMissing(ctx context.Context, collection *mongo.Collection, companyID primitive.ObjectID, entity string, id string) error {
+	n, err := collection.CountDocuments(ctx, bson.M{"company_id": companyID, "id": id})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%v %v %w", entity, id, ErrStale)
+	}
+	return fmt.Errorf("%v %w", entity, ErrNotFound)
+}
+
+func isNoDocuments(err error) bool {
+	return errors.Is(err, mongo.ErrNoDocuments)
+}
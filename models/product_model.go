@@ -2,15 +2,11 @@ package models
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
 	"log"
-	"os"
 	"time"
 )
 
@@ -19,37 +15,37 @@ type Product struct {
 	Name               string     `json:"name" bson:"name"`
 	MadeIn             string     `json:"made_in" bson:"made_in"`
 	Materials          []Material `json:"materials" bson:"materials"`
+	BOM                []BOMLine  `json:"bom" bson:"bom"`
+	Lots               []string   `json:"lots" bson:"lots"`
+	Costs              []CostLine `json:"costs" bson:"costs"`
 	Price              float64    `json:"price" bson:"price"`
 	Description        string     `json:"description" bson:"description"`
 	SustainablePackage bool       `json:"sustainablePackage" bson:"sustainablePackage"`
+	Version            int        `json:"version" bson:"version"`
+}
+
+// productDocument is how a product is stored in the products collection
+type productDocument struct {
+	CompanyID primitive.ObjectID `bson:"company_id"`
+	Product   `bson:",inline"`
 }
 
 type ProductModel struct {
 	COLLECTION *mongo.Collection
+	REFERENCES ReferenceMode
 }
 
 // ProductModel methods
-func (p *ProductModel) Add(product Product) error {
-	company := os.Getenv("COMPANY")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (p *ProductModel) Add(ctx context.Context, product Product) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-	var result bson.M
-	err := p.COLLECTION.FindOne(ctx, bson.D{{"name", companyFirstLMaiusc}}).Decode(&result)
+	companyID, err := mongoCompanyID(ctx)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil
-		}
 		return err
 	}
 
-	filter := bson.D{{"name", companyFirstLMaiusc}}
-	update := bson.D{{"$push", bson.D{{"products", product}}}}
-
-	_, err = p.COLLECTION.UpdateOne(ctx, filter, update)
+	_, err = p.COLLECTION.InsertOne(ctx, productDocument{companyID, storedProduct(product, p.REFERENCES)})
 	if err != nil {
 		log.Println("Failed to insert product: ", err)
 		return err
@@ -57,210 +53,116 @@ func (p *ProductModel) Add(product Product) error {
 	return nil
 }
 
-func (p *ProductModel) Update(product Product) error {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (p *ProductModel) Update(ctx context.Context, product Product) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{"name": companyFirstLMaiusc, "products.id": product.Id}
-	update := bson.D{{"$set", bson.D{{"products.$", product}}}}
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
 
-	res, err := p.COLLECTION.UpdateOne(ctx, filter, update)
+	filter := bson.M{"company_id": companyID, "id": product.Id, "version": versionFilter(product.Version)}
+	product.Version++
+	res, err := p.COLLECTION.ReplaceOne(ctx, filter, productDocument{companyID, storedProduct(product, p.REFERENCES)})
 	if err != nil {
 		return err
 	}
 	if res.MatchedCount != 0 {
-		fmt.Printf("matched and replaced product %v", product.Id)
+		log.Printf("matched and replaced product %v", product.Id)
 		return nil
 	}
 
-	return errors.New("product not found")
+	return staleOrMissing(ctx, p.COLLECTION, companyID, "product", product.Id)
 }
 
-func (p *ProductModel) GetAll() ([]Product, error) {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var result bson.M
-
-	err := p.COLLECTION.FindOne(ctx, bson.D{{"name", companyFirstLMaiusc}}).Decode(&result)
+// find returns the products of the current company matching filter
+func (p *ProductModel) find(ctx context.Context, filter bson.M) ([]Product, error) {
+	companyID, err := mongoCompanyID(ctx)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, nil
-		}
 		return nil, err
 	}
+	filter["company_id"] = companyID
 
-	productsRaw, ok := result["products"]
-	if !ok {
-		return nil, errors.New("field 'products' not found")
-	}
-
-	productsJSON, err := json.Marshal(productsRaw)
-	if err != nil {
+	var documents []productDocument
+	if err := findAll(ctx, p.COLLECTION, filter, &documents); err != nil {
 		return nil, err
 	}
 
-	var products []Product
-	err = json.Unmarshal(productsJSON, &products)
-	if err != nil {
-		return nil, err
+	products := make([]Product, 0, len(documents))
+	for _, document := range documents {
+		products = append(products, document.Product)
 	}
 
+	if p.REFERENCES != ReferenceEmbedded {
+		if err := resolveMongoProducts(ctx, p.COLLECTION.Database(), companyID, products); err != nil {
+			return nil, err
+		}
+	}
 	return products, nil
 }
 
-func (p *ProductModel) GetOne(id string) (*Product, error) {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (p *ProductModel) GetAll(ctx context.Context) ([]Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	pipeline := bson.A{
-		bson.D{
-			{"$match", bson.D{{"name", companyFirstLMaiusc}}},
-		},
-		bson.D{
-			{"$unwind", "$products"},
-		},
-		bson.D{
-			{"$match", bson.D{{"products.id", id}}},
-		},
-	}
+	return p.find(ctx, bson.M{})
+}
 
-	cursor, err := p.COLLECTION.Aggregate(ctx, pipeline)
+func (p *ProductModel) GetOne(ctx context.Context, id string) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	products, err := p.find(ctx, bson.M{"id": id})
 	if err != nil {
 		return nil, err
 	}
-
-	/* bson.M regular map[string]interface{} when encoding and decoding,
-	una mappa in cui le chiavi sono stringhe e i valori sono di
-	tipo interface{}, il che significa che possono essere di qualsiasi tipo */
-	var results []bson.M
-	if err := cursor.All(ctx, &results); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			fmt.Println("Object not found")
-			return nil, nil
-		} else {
-			log.Fatal(err)
-			return nil, err
-		}
-	}
-
-	if len(results) > 0 {
-		productBytes, err := json.Marshal(results[0]["products"])
-		if err != nil {
-			return nil, err
-		}
-
-		var myProduct Product
-		err = json.Unmarshal(productBytes, &myProduct)
-		if err != nil {
-			return nil, err
-		}
-
-		return &myProduct, nil
+	if len(products) > 0 {
+		return &products[0], nil
 	}
 
-	return nil, fmt.Errorf("product with ID %v not found", id)
+	return nil, fmt.Errorf("product with ID %v %w", id, ErrNotFound)
 }
 
-func (p *ProductModel) GetByMaterial(materialID string) (*[]Product, error) {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (p *ProductModel) GetByMaterial(ctx context.Context, materialID string) (*[]Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	pipeline := bson.A{
-		bson.D{
-			{"$match", bson.D{{"name", companyFirstLMaiusc}}},
-		},
-		bson.D{
-			{"$unwind", "$products"},
-		},
-		bson.D{
-			{"$match", bson.D{{"products.materials.id", materialID}}},
-		},
-	}
-
-	cursor, err := p.COLLECTION.Aggregate(ctx, pipeline)
+	products, err := p.find(ctx, bson.M{"materials.id": materialID})
 	if err != nil {
 		return nil, err
 	}
-
-	var results []bson.M
-	if err := cursor.All(ctx, &results); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			log.Println("Object not found")
-			return nil, nil
-		} else {
-			log.Fatal(err)
-			return nil, err
-		}
+	if len(products) > 0 {
+		return &products, nil
 	}
 
-	if len(results) > 0 {
-		var myProducts []Product
-		for _, product := range results {
-			var prod Product
-			productBytes, err := json.Marshal(product["products"])
-			if err != nil {
-				return nil, err
-			}
-			err = json.Unmarshal(productBytes, &prod)
-			if err != nil {
-				return nil, err
-			}
-			myProducts = append(myProducts, prod)
-		}
+	return nil, fmt.Errorf("products with material with ID %v %w", materialID, ErrNotFound)
+}
 
-		return &myProducts, nil
-	}
+func (p *ProductModel) GetByLot(ctx context.Context, lotID string) ([]Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
 
-	return nil, fmt.Errorf("products with material with ID %v not found", materialID)
+	return p.find(ctx, bson.M{"lots": lotID})
 }
 
-func (p *ProductModel) DeleteOne(id string) error {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (p *ProductModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	product, err := p.GetOne(id)
+	companyID, err := mongoCompanyID(ctx)
 	if err != nil {
 		return err
 	}
 
-	if product != nil {
-		filter := bson.D{{"name", companyFirstLMaiusc}}
-		update := bson.D{
-			{"$pull", bson.D{
-				{"products", bson.D{{"id", id}}},
-			}},
-		}
-
-		res, err := p.COLLECTION.UpdateOne(ctx, filter, update)
-		if err != nil {
-			return err
-		}
-		if res.MatchedCount != 0 {
-			fmt.Printf("matched and deleted product %v", id)
-			return nil
-		}
+	res, err := p.COLLECTION.DeleteOne(ctx, bson.M{"company_id": companyID, "id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount != 0 {
+		log.Printf("matched and deleted product %v", id)
+		return nil
 	}
 
-	return errors.New("something went wrong")
+	return fmt.Errorf("product with ID %v %w", id, ErrNotFound)
 }
@@ -0,0 +1,32 @@
+package models
+
+// CustodyStep is one holder of a material on its way from where it was
+// extracted to the supplier it is bought from. The steps of a material are
+// kept in chain order, Date is YYYY-MM-DD like the certification dates.
+type CustodyStep struct {
+	Stage     string   `json:"stage" bson:"stage"`
+	Name      string   `json:"name" bson:"name"`
+	Location  string   `json:"location" bson:"location"`
+	Date      string   `json:"date" bson:"date"`
+	Documents []string `json:"documents,omitempty" bson:"documents,omitempty"`
+}
+
+const (
+	StageExtraction = "extraction"
+	StageRefiner    = "refiner"
+	StageTrader     = "trader"
+	StageSupplier   = "supplier"
+)
+
+// Stages lists the stages of a chain of custody in the order they come in
+var Stages = []string{StageExtraction, StageRefiner, StageTrader, StageSupplier}
+
+// StageOrder returns the position of stage in Stages, -1 when unknown
+func StageOrder(stage string) int {
+	for i, known := range Stages {
+		if stage == known {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,51 @@
+package models
+
+import "fmt"
+
+// ReferenceMode decides how products keep their materials and materials keep
+// their supplier on the document backends (MongoDB and memory).
+//
+// With ReferenceByID only the IDs are written and reads resolve them to the
+// current records, so renaming a supplier shows up everywhere. With
+// ReferenceEmbedded full copies are written and read back as they were saved.
+// The SQL backends always work by ID through foreign keys.
+type ReferenceMode string
+
+const (
+	ReferenceByID     ReferenceMode = "id"
+	ReferenceEmbedded ReferenceMode = "embedded"
+)
+
+// ParseReferenceMode reads the REFERENCE_MODE value, by ID when empty
+func ParseReferenceMode(value string) (ReferenceMode, error) {
+	switch ReferenceMode(value) {
+	case "", ReferenceByID:
+		return ReferenceByID, nil
+	case ReferenceEmbedded:
+		return ReferenceEmbedded, nil
+	default:
+		return "", fmt.Errorf("unknown REFERENCE_MODE %q", value)
+	}
+}
+
+// storedProduct returns product as it has to be written with mode
+func storedProduct(product Product, mode ReferenceMode) Product {
+	if mode == ReferenceEmbedded {
+		return product
+	}
+	materials := make([]Material, len(product.Materials))
+	for i, material := range product.Materials {
+		materials[i] = Material{Id: material.Id}
+	}
+	product.Materials = materials
+	return product
+}
+
+// storedMaterial returns material as it has to be written with mode
+func storedMaterial(material Material, mode ReferenceMode) Material {
+	if mode == ReferenceEmbedded {
+		return material
+	}
+	material.Supplier = Supplier{Id: material.Supplier.Id}
+	return material
+}
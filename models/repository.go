@@ -0,0 +1,137 @@
+package models
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is wrapped by every backend when the requested record does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is wrapped when a change would break the references between
+// records, e.g. deleting a supplier that materials still point to
+var ErrConflict = errors.New("conflicting references")
+
+// ErrDuplicate is wrapped when a record would take a name or ID already in use
+var ErrDuplicate = errors.New("already exists")
+
+// ErrStale is wrapped by Update when the record changed since the version the
+// caller read. Products, materials, suppliers, certs and lots carry a Version that
+// Update expects to match the stored one and then increments.
+var ErrStale = errors.New("was changed by someone else, reload it")
+
+// Repositories used by the handlers. The Mongo models in this package are one
+// implementation, any other storage backend only has to satisfy these.
+
+type ProductRepository interface {
+	Add(ctx context.Context, product Product) error
+	Update(ctx context.Context, product Product) error
+	GetAll(ctx context.Context) ([]Product, error)
+	GetOne(ctx context.Context, id string) (*Product, error)
+	GetByMaterial(ctx context.Context, materialID string) (*[]Product, error)
+	GetByLot(ctx context.Context, lotID string) ([]Product, error)
+	DeleteOne(ctx context.Context, id string) error
+}
+
+type MaterialRepository interface {
+	Add(ctx context.Context, material Material) error
+	Update(ctx context.Context, material Material) error
+	GetAll(ctx context.Context) ([]Material, error)
+	GetOne(ctx context.Context, id string) (*Material, error)
+	GetBySupplier(ctx context.Context, supplierID string) (*[]Material, error)
+	DeleteOne(ctx context.Context, id string) error
+}
+
+type SupplierRepository interface {
+	Add(ctx context.Context, supplier Supplier) error
+	Update(ctx context.Context, supplier Supplier) error
+	GetAll(ctx context.Context) ([]Supplier, error)
+	GetOne(ctx context.Context, id string) (*Supplier, error)
+	DeleteOne(ctx context.Context, id string) error
+}
+
+type CertRepository interface {
+	Add(ctx context.Context, cert Cert) error
+	Update(ctx context.Context, cert Cert) error
+	GetAll(ctx context.Context) ([]Cert, error)
+	GetOne(ctx context.Context, id string) (*Cert, error)
+	GetBySubject(ctx context.Context, subjectID string) (*[]Cert, error)
+	DeleteOne(ctx context.Context, id string) error
+}
+
+// LotRepository stores the lots of the company in the context, GetByMaterial
+// returns an empty list when the material has no lot
+type LotRepository interface {
+	Add(ctx context.Context, lot Lot) error
+	Update(ctx context.Context, lot Lot) error
+	GetAll(ctx context.Context) ([]Lot, error)
+	GetOne(ctx context.Context, id string) (*Lot, error)
+	GetByMaterial(ctx context.Context, materialID string) ([]Lot, error)
+	DeleteOne(ctx context.Context, id string) error
+}
+
+type CompanyRepository interface {
+	Initialize(ctx context.Context, company Company) error
+	GetAll(ctx context.Context) ([]Company, error)
+	GetOne(ctx context.Context, id string) (*Company, error)
+	Rename(ctx context.Context, id string, name string) error
+	DeleteOne(ctx context.Context, id string) error
+}
+
+// APIKeyRepository stores the API keys of the company in the context,
+// FindByHash searches every company
+type APIKeyRepository interface {
+	Add(ctx context.Context, key APIKey) error
+	GetAll(ctx context.Context) ([]APIKey, error)
+	FindByHash(ctx context.Context, hash string) (*APIKey, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+// UserRepository stores the users of the company in the context,
+// FindByEmail searches every company
+type UserRepository interface {
+	Add(ctx context.Context, user User) error
+	Update(ctx context.Context, user User) error
+	GetAll(ctx context.Context) ([]User, error)
+	GetOne(ctx context.Context, id string) (*User, error)
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	DeleteOne(ctx context.Context, id string) error
+}
+
+// SessionRepository stores the logins of users, GetOne and Revoke work across
+// companies so tokens can be checked before the company is known
+type SessionRepository interface {
+	Add(ctx context.Context, session Session) error
+	GetOne(ctx context.Context, id string) (*Session, error)
+	Revoke(ctx context.Context, id string) error
+	RevokeByUser(ctx context.Context, userID string, except string) error
+}
+
+// Repositories groups one implementation of every repository, main picks the backend
+type Repositories struct {
+	Products  ProductRepository
+	Materials MaterialRepository
+	Suppliers SupplierRepository
+	Certs     CertRepository
+	Lots      LotRepository
+	Company   CompanyRepository
+	APIKeys   APIKeyRepository
+	Users     UserRepository
+	Sessions  SessionRepository
+	Audit     AuditRepository
+	Trash     TrashRepository
+}
+
+var (
+	_ ProductRepository  = (*ProductModel)(nil)
+	_ MaterialRepository = (*MaterialModel)(nil)
+	_ SupplierRepository = (*SupplierModel)(nil)
+	_ CertRepository     = (*CertModel)(nil)
+	_ LotRepository      = (*LotModel)(nil)
+	_ CompanyRepository  = (*CompanyModel)(nil)
+	_ APIKeyRepository   = (*APIKeyModel)(nil)
+	_ UserRepository     = (*UserModel)(nil)
+	_ SessionRepository  = (*SessionModel)(nil)
+	_ AuditRepository    = (*AuditModel)(nil)
+	_ TrashRepository    = (*TrashModel)(nil)
+)
@@ -0,0 +1,81 @@
+package models
+
+// Role decides what a user or an API key is allowed to do inside its company
+type Role string
+
+const (
+	RoleAdmin      Role = "admin"
+	RoleBuyer      Role = "buyer"
+	RoleProduction Role = "production"
+	RoleAuditor    Role = "auditor"
+)
+
+// Permission is what a route requires, named after the records it touches and
+// what it does to them
+type Permission string
+
+const (
+	PermProductsRead    Permission = "products:read"
+	PermProductsWrite   Permission = "products:write"
+	PermProductsDelete  Permission = "products:delete"
+	PermMaterialsRead   Permission = "materials:read"
+	PermMaterialsWrite  Permission = "materials:write"
+	PermMaterialsDelete Permission = "materials:delete"
+	PermSuppliersRead   Permission = "suppliers:read"
+	PermSuppliersWrite  Permission = "suppliers:write"
+	PermSuppliersDelete Permission = "suppliers:delete"
+	PermCertsRead       Permission = "certs:read"
+	PermCertsWrite      Permission = "certs:write"
+	PermCertsDelete     Permission = "certs:delete"
+	PermLotsRead        Permission = "lots:read"
+	PermLotsWrite       Permission = "lots:write"
+	PermLotsDelete      Permission = "lots:delete"
+	PermUsersManage     Permission = "users:manage"
+	PermKeysManage      Permission = "keys:manage"
+	PermAuditRead       Permission = "audit:read"
+	PermTrashRead       Permission = "trash:read"
+	PermTrashManage     Permission = "trash:manage"
+	// PermCompanyManage is only held by the admin key, company admins
+	// cannot create or delete companies
+	PermCompanyManage Permission = "company:manage"
+)
+
+// readAll is what every role can see
+var readAll = []Permission{PermProductsRead, PermMaterialsRead, PermSuppliersRead, PermCertsRead, PermLotsRead}
+
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: append(readAll,
+		PermProductsWrite, PermProductsDelete,
+		PermMaterialsWrite, PermMaterialsDelete,
+		PermSuppliersWrite, PermSuppliersDelete,
+		PermCertsWrite, PermCertsDelete,
+		PermLotsWrite, PermLotsDelete,
+		PermUsersManage, PermKeysManage, PermAuditRead,
+		PermTrashRead, PermTrashManage,
+	),
+	RoleBuyer:      append(readAll, PermSuppliersWrite, PermMaterialsWrite, PermCertsWrite, PermLotsWrite),
+	RoleProduction: append(readAll, PermProductsWrite),
+	RoleAuditor:    append(readAll, PermAuditRead, PermTrashRead),
+}
+
+// Valid reports whether r is one of the known roles
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether r grants permission
+func (r Role) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the principal holds permission, the admin key holds
+// every permission
+func (p Principal) Can(permission Permission) bool {
+	return p.Admin || p.Role.Can(permission)
+}
@@ -0,0 +1,1674 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"strings"
+	"time"
+)
+
+// SQL models work on the relational schema created by the db migrations, the
+// same queries run on SQLite and PostgreSQL. Suppliers, materials and products
+// live in their own tables and a material only keeps the ID of its supplier as
+// a foreign key, the same goes for the materials of a product through
+// product_materials. Reads join the referenced records back in.
+
+func NewSQLRepositories(conn *sql.DB) *Repositories {
+	return withAudit(withTrash(&Repositories{
+		Products:  &SQLProductModel{DB: conn},
+		Materials: &SQLMaterialModel{DB: conn},
+		Suppliers: &SQLSupplierModel{DB: conn},
+		Certs:     &SQLCertModel{DB: conn},
+		Lots:      &SQLLotModel{DB: conn},
+		Company:   &SQLCompanyModel{DB: conn},
+		APIKeys:   &SQLAPIKeyModel{DB: conn},
+		Users:     &SQLUserModel{DB: conn},
+		Sessions:  &SQLSessionModel{DB: conn},
+		Audit:     &SQLAuditModel{DB: conn},
+		Trash:     &SQLTrashModel{DB: conn},
+	}))
+}
+
+// nullableID stores missing references as NULL so foreign keys are not checked
+func nullableID(id string) interface{} {
+	if id == "" {
+		return nil
+	}
+	return id
+}
+
+const sqlMaterialColumns = `m.id, m.name, m.origin, m.provenance_json, m.costs_json, m.sustainable, m.details, m.last_order, m.version,
+	COALESCE(s.id, ''), COALESCE(s.name, ''), COALESCE(s.country, ''), COALESCE(s.city, ''), COALESCE(s.version, 0)`
+
+const sqlSupplierJoin = `LEFT JOIN suppliers s ON s.id = m.supplier_id`
+
+// sqlError marks foreign key violations as ErrConflict, whatever the driver
+func sqlError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return fmt.Errorf("%v: %w", pqErr.Message, ErrConflict)
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY {
+		return fmt.Errorf("%v: %w", sqliteErr, ErrConflict)
+	}
+	return err
+}
+
+// sqlDuplicate tells whether err is a unique constraint violation
+func sqlDuplicate(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	}
+	return false
+}
+
+// sqlReferences returns the IDs selected by query, used to name the records
+// that still point to one being deleted
+func sqlReferences(ctx context.Context, conn *sql.DB, query string, id string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var ref string
+		if err := rows.Scan(&ref); err != nil {
+			return nil, err
+		}
+		ids = append(ids, ref)
+	}
+	return ids, rows.Err()
+}
+
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sqlStaleOrMissing explains why an update matching on version changed no row
+func sqlStaleOrMissing(ctx context.Context, db rowQuerier, table string, entity string, id string, companyID string) error {
+	var exists bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id = $1 AND company_id = $2)`, id, companyID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%v %v %w", entity, id, ErrStale)
+	}
+	return fmt.Errorf("%v %w", entity, ErrNotFound)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSQLMaterial(row rowScanner, extra ...interface{}) (Material, error) {
+	var material Material
+	var provenance, costs string
+	dest := append(extra,
+		&material.Id, &material.Name, &material.Origin, &provenance, &costs, &material.Sustainable, &material.Details, &material.LastOrder, &material.Version,
+		&material.Supplier.Id, &material.Supplier.Name, &material.Supplier.Country, &material.Supplier.City, &material.Supplier.Version)
+	if err := row.Scan(dest...); err != nil {
+		return material, err
+	}
+	if err := json.Unmarshal([]byte(provenance), &material.Provenance); err != nil {
+		return material, err
+	}
+	err := json.Unmarshal([]byte(costs), &material.Costs)
+	return material, err
+}
+
+// provenanceJSON is how the chain of custody of material is stored
+func provenanceJSON(material Material) (string, error) {
+	steps := material.Provenance
+	if steps == nil {
+		steps = []CustodyStep{}
+	}
+	provenance, err := json.Marshal(steps)
+	return string(provenance), err
+}
+
+// unitCostsJSON is how the price history of material is stored
+func unitCostsJSON(material Material) (string, error) {
+	costs := material.Costs
+	if costs == nil {
+		costs = []UnitCost{}
+	}
+	stored, err := json.Marshal(costs)
+	return string(stored), err
+}
+
+// costLinesJSON is how the labor and overhead of product are stored
+func costLinesJSON(product Product) (string, error) {
+	lines := product.Costs
+	if lines == nil {
+		lines = []CostLine{}
+	}
+	stored, err := json.Marshal(lines)
+	return string(stored), err
+}
+
+type SQLProductModel struct {
+	DB *sql.DB
+}
+
+// SQLProductModel methods
+func (p *SQLProductModel) Add(ctx context.Context, product Product) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	costs, err := costLinesJSON(product)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO products (id, company_id, name, made_in, costs_json, price, description, sustainable_package, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		product.Id, companyID, product.Name, product.MadeIn, costs, product.Price, product.Description, product.SustainablePackage, product.Version)
+	if err != nil {
+		log.Println("Failed to insert product: ", err)
+		return sqlError(err)
+	}
+	if err := insertProductMaterials(ctx, tx, product); err != nil {
+		return err
+	}
+	if err := insertProductLots(ctx, tx, product); err != nil {
+		return err
+	}
+	if err := insertProductBOM(ctx, tx, product); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertProductMaterials(ctx context.Context, tx *sql.Tx, product Product) error {
+	for i, material := range product.Materials {
+		_, err := tx.ExecContext(ctx, `INSERT INTO product_materials (product_id, material_id, position) VALUES ($1, $2, $3)`,
+			product.Id, material.Id, i)
+		if err != nil {
+			return fmt.Errorf("failed to link material %v: %w", material.Id, sqlError(err))
+		}
+	}
+	return nil
+}
+
+func insertProductLots(ctx context.Context, tx *sql.Tx, product Product) error {
+	for i, lotID := range product.Lots {
+		_, err := tx.ExecContext(ctx, `INSERT INTO product_lots (product_id, lot_id, position) VALUES ($1, $2, $3)`,
+			product.Id, lotID, i)
+		if err != nil {
+			return fmt.Errorf("failed to link lot %v: %w", lotID, sqlError(err))
+		}
+	}
+	return nil
+}
+
+func insertProductBOM(ctx context.Context, tx *sql.Tx, product Product) error {
+	for i, line := range product.BOM {
+		_, err := tx.ExecContext(ctx, `INSERT INTO product_bom (product_id, material_id, position, quantity, unit, waste_pct)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			product.Id, line.MaterialID, i, line.Quantity, line.Unit, line.WastePct)
+		if err != nil {
+			return fmt.Errorf("failed to add the bill of materials line of %v: %w", line.MaterialID, sqlError(err))
+		}
+	}
+	return nil
+}
+
+func (p *SQLProductModel) Update(ctx context.Context, product Product) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	costs, err := costLinesJSON(product)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE products SET name = $1, made_in = $2, costs_json = $3, price = $4, description = $5,
+		sustainable_package = $6, version = version + 1 WHERE id = $7 AND company_id = $8 AND version = $9`,
+		product.Name, product.MadeIn, costs, product.Price, product.Description, product.SustainablePackage, product.Id, companyID, product.Version)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sqlStaleOrMissing(ctx, tx, "products", "product", product.Id, companyID)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM product_materials WHERE product_id = $1`, product.Id); err != nil {
+		return err
+	}
+	if err := insertProductMaterials(ctx, tx, product); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM product_lots WHERE product_id = $1`, product.Id); err != nil {
+		return err
+	}
+	if err := insertProductLots(ctx, tx, product); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM product_bom WHERE product_id = $1`, product.Id); err != nil {
+		return err
+	}
+	if err := insertProductBOM(ctx, tx, product); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("matched and replaced product %v", product.Id)
+	return nil
+}
+
+// query loads the products matching where, which can use $1 as the company ID
+func (p *SQLProductModel) query(ctx context.Context, companyID string, where string, args ...interface{}) ([]Product, error) {
+	args = append([]interface{}{companyID}, args...)
+	rows, err := p.DB.QueryContext(ctx, `SELECT id, name, made_in, costs_json, price, description, sustainable_package, version
+		FROM products WHERE company_id = $1 AND `+where+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []Product{}
+	for rows.Next() {
+		var product Product
+		var costs string
+		err := rows.Scan(&product.Id, &product.Name, &product.MadeIn, &costs, &product.Price, &product.Description, &product.SustainablePackage, &product.Version)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(costs), &product.Costs); err != nil {
+			return nil, err
+		}
+		product.Materials = []Material{}
+		product.BOM = []BOMLine{}
+		product.Lots = []string{}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(products) == 0 {
+		return products, nil
+	}
+
+	index := map[string]int{}
+	placeholders := make([]string, len(products))
+	ids := make([]interface{}, len(products))
+	for i, product := range products {
+		index[product.Id] = i
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		ids[i] = product.Id
+	}
+
+	rows, err = p.DB.QueryContext(ctx, `SELECT pm.product_id, `+sqlMaterialColumns+`
+		FROM product_materials pm JOIN materials m ON m.id = pm.material_id `+sqlSupplierJoin+`
+		WHERE pm.product_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY pm.product_id, pm.position`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID string
+		material, err := scanSQLMaterial(rows, &productID)
+		if err != nil {
+			return nil, err
+		}
+		i := index[productID]
+		products[i].Materials = append(products[i].Materials, material)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = p.DB.QueryContext(ctx, `SELECT product_id, lot_id FROM product_lots
+		WHERE product_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY product_id, position`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID, lotID string
+		if err := rows.Scan(&productID, &lotID); err != nil {
+			return nil, err
+		}
+		i := index[productID]
+		products[i].Lots = append(products[i].Lots, lotID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = p.DB.QueryContext(ctx, `SELECT product_id, material_id, quantity, unit, waste_pct FROM product_bom
+		WHERE product_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY product_id, position`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID string
+		var line BOMLine
+		if err := rows.Scan(&productID, &line.MaterialID, &line.Quantity, &line.Unit, &line.WastePct); err != nil {
+			return nil, err
+		}
+		i := index[productID]
+		products[i].BOM = append(products[i].BOM, line)
+	}
+	return products, rows.Err()
+}
+
+func (p *SQLProductModel) GetAll(ctx context.Context) ([]Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.query(ctx, companyID, "1 = 1")
+}
+
+func (p *SQLProductModel) GetOne(ctx context.Context, id string) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	products, err := p.query(ctx, companyID, "id = $2", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(products) > 0 {
+		return &products[0], nil
+	}
+	return nil, fmt.Errorf("product with ID %v %w", id, ErrNotFound)
+}
+
+func (p *SQLProductModel) GetByMaterial(ctx context.Context, materialID string) (*[]Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	products, err := p.query(ctx, companyID, "id IN (SELECT product_id FROM product_materials WHERE material_id = $2)", materialID)
+	if err != nil {
+		return nil, err
+	}
+	if len(products) > 0 {
+		return &products, nil
+	}
+	return nil, fmt.Errorf("products with material with ID %v %w", materialID, ErrNotFound)
+}
+
+func (p *SQLProductModel) GetByLot(ctx context.Context, lotID string) ([]Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.query(ctx, companyID, "id IN (SELECT product_id FROM product_lots WHERE lot_id = $2)", lotID)
+}
+
+func (p *SQLProductModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.DB.ExecContext(ctx, `DELETE FROM products WHERE id = $1 AND company_id = $2`, id, companyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("product with ID %v %w", id, ErrNotFound)
+	}
+	log.Printf("matched and deleted product %v", id)
+	return nil
+}
+
+type SQLMaterialModel struct {
+	DB *sql.DB
+}
+
+// SQLMaterialModel methods
+func (m *SQLMaterialModel) Add(ctx context.Context, material Material) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	provenance, err := provenanceJSON(material)
+	if err != nil {
+		return err
+	}
+	costs, err := unitCostsJSON(material)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `INSERT INTO materials (id, company_id, name, supplier_id, origin, provenance_json, costs_json, sustainable, details, last_order, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		material.Id, companyID, material.Name, nullableID(material.Supplier.Id), material.Origin, provenance, costs, material.Sustainable,
+		material.Details, material.LastOrder, material.Version)
+	if err != nil {
+		log.Println("Failed to insert material: ", err)
+		return sqlError(err)
+	}
+	return nil
+}
+
+func (m *SQLMaterialModel) Update(ctx context.Context, material Material) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	provenance, err := provenanceJSON(material)
+	if err != nil {
+		return err
+	}
+	costs, err := unitCostsJSON(material)
+	if err != nil {
+		return err
+	}
+
+	res, err := m.DB.ExecContext(ctx, `UPDATE materials SET name = $1, supplier_id = $2, origin = $3, provenance_json = $4, costs_json = $5,
+		sustainable = $6, details = $7, last_order = $8, version = version + 1 WHERE id = $9 AND company_id = $10 AND version = $11`,
+		material.Name, nullableID(material.Supplier.Id), material.Origin, provenance, costs, material.Sustainable, material.Details,
+		material.LastOrder, material.Id, companyID, material.Version)
+	if err != nil {
+		return sqlError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sqlStaleOrMissing(ctx, m.DB, "materials", "material", material.Id, companyID)
+	}
+	log.Printf("matched and replaced material %v", material.Id)
+	return nil
+}
+
+// query loads the materials matching where, which can use $1 as the company ID
+func (m *SQLMaterialModel) query(ctx context.Context, companyID string, where string, args ...interface{}) ([]Material, error) {
+	args = append([]interface{}{companyID}, args...)
+	rows, err := m.DB.QueryContext(ctx, `SELECT `+sqlMaterialColumns+` FROM materials m `+sqlSupplierJoin+`
+		WHERE m.company_id = $1 AND `+where+` ORDER BY m.seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	materials := []Material{}
+	for rows.Next() {
+		material, err := scanSQLMaterial(rows)
+		if err != nil {
+			return nil, err
+		}
+		materials = append(materials, material)
+	}
+	return materials, rows.Err()
+}
+
+func (m *SQLMaterialModel) GetAll(ctx context.Context) ([]Material, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.query(ctx, companyID, "1 = 1")
+}
+
+func (m *SQLMaterialModel) GetOne(ctx context.Context, id string) (*Material, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	materials, err := m.query(ctx, companyID, "m.id = $2", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(materials) > 0 {
+		return &materials[0], nil
+	}
+	return nil, fmt.Errorf("material with ID %v %w", id, ErrNotFound)
+}
+
+func (m *SQLMaterialModel) GetBySupplier(ctx context.Context, supplierID string) (*[]Material, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	materials, err := m.query(ctx, companyID, "m.supplier_id = $2", supplierID)
+	if err != nil {
+		return nil, err
+	}
+	if len(materials) > 0 {
+		return &materials, nil
+	}
+	return nil, fmt.Errorf("materials for supplier with ID %v %w", supplierID, ErrNotFound)
+}
+
+func (m *SQLMaterialModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	products, err := sqlReferences(ctx, m.DB, `SELECT DISTINCT product_id FROM product_materials WHERE material_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if len(products) > 0 {
+		return fmt.Errorf("material %v is still used by products %v: %w", id, strings.Join(products, ", "), ErrConflict)
+	}
+
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM materials WHERE id = $1 AND company_id = $2`, id, companyID)
+	if err != nil {
+		return sqlError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("material with ID %v %w", id, ErrNotFound)
+	}
+	log.Printf("matched and deleted material %v", id)
+	return nil
+}
+
+type SQLSupplierModel struct {
+	DB *sql.DB
+}
+
+// SQLSupplierModel methods
+func (s *SQLSupplierModel) Add(ctx context.Context, supplier Supplier) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DB.ExecContext(ctx, `INSERT INTO suppliers (id, company_id, name, country, city, version) VALUES ($1, $2, $3, $4, $5, $6)`,
+		supplier.Id, companyID, supplier.Name, supplier.Country, supplier.City, supplier.Version)
+	if err != nil {
+		log.Println("Failed to insert supplier: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *SQLSupplierModel) Update(ctx context.Context, supplier Supplier) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.DB.ExecContext(ctx, `UPDATE suppliers SET name = $1, country = $2, city = $3, version = version + 1
+		WHERE id = $4 AND company_id = $5 AND version = $6`,
+		supplier.Name, supplier.Country, supplier.City, supplier.Id, companyID, supplier.Version)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sqlStaleOrMissing(ctx, s.DB, "suppliers", "supplier", supplier.Id, companyID)
+	}
+	log.Printf("matched and replaced supplier %v", supplier.Id)
+	return nil
+}
+
+// query loads the suppliers matching where, which can use $1 as the company ID
+func (s *SQLSupplierModel) query(ctx context.Context, companyID string, where string, args ...interface{}) ([]Supplier, error) {
+	args = append([]interface{}{companyID}, args...)
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, name, country, city, version FROM suppliers
+		WHERE company_id = $1 AND `+where+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suppliers := []Supplier{}
+	for rows.Next() {
+		var supplier Supplier
+		if err := rows.Scan(&supplier.Id, &supplier.Name, &supplier.Country, &supplier.City, &supplier.Version); err != nil {
+			return nil, err
+		}
+		suppliers = append(suppliers, supplier)
+	}
+	return suppliers, rows.Err()
+}
+
+func (s *SQLSupplierModel) GetAll(ctx context.Context) ([]Supplier, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.query(ctx, companyID, "1 = 1")
+}
+
+func (s *SQLSupplierModel) GetOne(ctx context.Context, id string) (*Supplier, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	suppliers, err := s.query(ctx, companyID, "id = $2", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(suppliers) > 0 {
+		return &suppliers[0], nil
+	}
+	return nil, fmt.Errorf("supplier with ID %v %w", id, ErrNotFound)
+}
+
+func (s *SQLSupplierModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	materials, err := sqlReferences(ctx, s.DB, `SELECT id FROM materials WHERE supplier_id = $1 ORDER BY seq`, id)
+	if err != nil {
+		return err
+	}
+	if len(materials) > 0 {
+		return fmt.Errorf("supplier %v is still referenced by materials %v: %w", id, strings.Join(materials, ", "), ErrConflict)
+	}
+
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM suppliers WHERE id = $1 AND company_id = $2`, id, companyID)
+	if err != nil {
+		return sqlError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("supplier with ID %v %w", id, ErrNotFound)
+	}
+	log.Printf("matched and deleted supplier %v", id)
+	return nil
+}
+
+type SQLCertModel struct {
+	DB *sql.DB
+}
+
+// SQLCertModel methods
+func (c *SQLCertModel) Add(ctx context.Context, cert Cert) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DB.ExecContext(ctx, `INSERT INTO certs (id, company_id, name, issuer, details, number, scope,
+		issue_date, expiry_date, subject_type, subject_id, version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		cert.Id, companyID, cert.Name, cert.Issuer, cert.Details, cert.Number, cert.Scope,
+		cert.IssueDate, cert.ExpiryDate, cert.Subject.Type, cert.Subject.Id, cert.Version)
+	if err != nil {
+		log.Println("Failed to insert certification: ", err)
+		return err
+	}
+	return nil
+}
+
+func (c *SQLCertModel) Update(ctx context.Context, cert Cert) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.DB.ExecContext(ctx, `UPDATE certs SET name = $1, issuer = $2, details = $3, number = $4, scope = $5,
+		issue_date = $6, expiry_date = $7, subject_type = $8, subject_id = $9, version = version + 1
+		WHERE id = $10 AND company_id = $11 AND version = $12`,
+		cert.Name, cert.Issuer, cert.Details, cert.Number, cert.Scope,
+		cert.IssueDate, cert.ExpiryDate, cert.Subject.Type, cert.Subject.Id, cert.Id, companyID, cert.Version)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sqlStaleOrMissing(ctx, c.DB, "certs", "certification", cert.Id, companyID)
+	}
+	log.Printf("matched and replaced certification %v", cert.Id)
+	return nil
+}
+
+// query loads the certifications matching where, which can use $1 as the company ID
+func (c *SQLCertModel) query(ctx context.Context, companyID string, where string, args ...interface{}) ([]Cert, error) {
+	args = append([]interface{}{companyID}, args...)
+	rows, err := c.DB.QueryContext(ctx, `SELECT id, name, issuer, details, number, scope,
+		issue_date, expiry_date, subject_type, subject_id, version FROM certs
+		WHERE company_id = $1 AND `+where+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certs := []Cert{}
+	for rows.Next() {
+		var cert Cert
+		err := rows.Scan(&cert.Id, &cert.Name, &cert.Issuer, &cert.Details, &cert.Number, &cert.Scope,
+			&cert.IssueDate, &cert.ExpiryDate, &cert.Subject.Type, &cert.Subject.Id, &cert.Version)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, rows.Err()
+}
+
+func (c *SQLCertModel) GetAll(ctx context.Context) ([]Cert, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.query(ctx, companyID, "1 = 1")
+}
+
+func (c *SQLCertModel) GetOne(ctx context.Context, id string) (*Cert, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := c.query(ctx, companyID, "id = $2", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) > 0 {
+		return &certs[0], nil
+	}
+	return nil, fmt.Errorf("certification with ID %v %w", id, ErrNotFound)
+}
+
+func (c *SQLCertModel) GetBySubject(ctx context.Context, subjectID string) (*[]Cert, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := c.query(ctx, companyID, "subject_id = $2", subjectID)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) > 0 {
+		return &certs, nil
+	}
+	return nil, fmt.Errorf("certifications for subject with ID %v %w", subjectID, ErrNotFound)
+}
+
+func (c *SQLCertModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.DB.ExecContext(ctx, `DELETE FROM certs WHERE id = $1 AND company_id = $2`, id, companyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("certification with ID %v %w", id, ErrNotFound)
+	}
+	log.Printf("matched and deleted certification %v", id)
+	return nil
+}
+
+type SQLLotModel struct {
+	DB *sql.DB
+}
+
+// SQLLotModel methods
+func (l *SQLLotModel) Add(ctx context.Context, lot Lot) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.DB.ExecContext(ctx, `INSERT INTO lots (id, company_id, material_id, supplier_id, quantity, unit,
+		received_at, assay, version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		lot.Id, companyID, lot.MaterialID, lot.SupplierID, lot.Quantity, lot.Unit, lot.ReceivedAt, lot.Assay, lot.Version)
+	if err != nil {
+		log.Println("Failed to insert lot: ", err)
+		return err
+	}
+	return nil
+}
+
+func (l *SQLLotModel) Update(ctx context.Context, lot Lot) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := l.DB.ExecContext(ctx, `UPDATE lots SET material_id = $1, supplier_id = $2, quantity = $3, unit = $4,
+		received_at = $5, assay = $6, version = version + 1 WHERE id = $7 AND company_id = $8 AND version = $9`,
+		lot.MaterialID, lot.SupplierID, lot.Quantity, lot.Unit, lot.ReceivedAt, lot.Assay, lot.Id, companyID, lot.Version)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sqlStaleOrMissing(ctx, l.DB, "lots", "lot", lot.Id, companyID)
+	}
+	log.Printf("matched and replaced lot %v", lot.Id)
+	return nil
+}
+
+// query loads the lots matching where, which can use $1 as the company ID
+func (l *SQLLotModel) query(ctx context.Context, companyID string, where string, args ...interface{}) ([]Lot, error) {
+	args = append([]interface{}{companyID}, args...)
+	rows, err := l.DB.QueryContext(ctx, `SELECT id, material_id, supplier_id, quantity, unit, received_at, assay, version
+		FROM lots WHERE company_id = $1 AND `+where+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lots := []Lot{}
+	for rows.Next() {
+		var lot Lot
+		err := rows.Scan(&lot.Id, &lot.MaterialID, &lot.SupplierID, &lot.Quantity, &lot.Unit, &lot.ReceivedAt, &lot.Assay, &lot.Version)
+		if err != nil {
+			return nil, err
+		}
+		lots = append(lots, lot)
+	}
+	return lots, rows.Err()
+}
+
+func (l *SQLLotModel) GetAll(ctx context.Context) ([]Lot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return l.query(ctx, companyID, "1 = 1")
+}
+
+func (l *SQLLotModel) GetOne(ctx context.Context, id string) (*Lot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lots, err := l.query(ctx, companyID, "id = $2", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(lots) > 0 {
+		return &lots[0], nil
+	}
+	return nil, fmt.Errorf("lot with ID %v %w", id, ErrNotFound)
+}
+
+func (l *SQLLotModel) GetByMaterial(ctx context.Context, materialID string) ([]Lot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return l.query(ctx, companyID, "material_id = $2", materialID)
+}
+
+func (l *SQLLotModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := l.DB.ExecContext(ctx, `DELETE FROM lots WHERE id = $1 AND company_id = $2`, id, companyID)
+	if err != nil {
+		return sqlError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("lot with ID %v %w", id, ErrNotFound)
+	}
+	log.Printf("matched and deleted lot %v", id)
+	return nil
+}
+
+type SQLCompanyModel struct {
+	DB *sql.DB
+}
+
+// SQLCompanyModel methods
+func (c *SQLCompanyModel) Initialize(ctx context.Context, company Company) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := c.DB.ExecContext(ctx, `INSERT INTO companies (id, name) VALUES ($1, $2)`, company.ID.Hex(), company.Name)
+	if sqlDuplicate(err) {
+		return fmt.Errorf("company %v %w", company.Name, ErrDuplicate)
+	}
+	if err != nil {
+		log.Println("Failed to insert company: ", err)
+		return err
+	}
+
+	log.Printf("Created new company with ID %v\n", company.ID.Hex())
+	return nil
+}
+
+// query loads the companies matching where, which can use $1
+func (c *SQLCompanyModel) query(ctx context.Context, where string, args ...interface{}) ([]Company, error) {
+	rows, err := c.DB.QueryContext(ctx, `SELECT id, name FROM companies WHERE `+where+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	companies := []Company{}
+	for rows.Next() {
+		var id string
+		var company Company
+		if err := rows.Scan(&id, &company.Name); err != nil {
+			return nil, err
+		}
+		if company.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, err
+		}
+		companies = append(companies, company)
+	}
+	return companies, rows.Err()
+}
+
+func (c *SQLCompanyModel) GetAll(ctx context.Context) ([]Company, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return c.query(ctx, "1 = 1")
+}
+
+func (c *SQLCompanyModel) GetOne(ctx context.Context, id string) (*Company, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companies, err := c.query(ctx, "id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(companies) > 0 {
+		return &companies[0], nil
+	}
+	return nil, fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+}
+
+func (c *SQLCompanyModel) Rename(ctx context.Context, id string, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	res, err := c.DB.ExecContext(ctx, `UPDATE companies SET name = $1 WHERE id = $2`, name, id)
+	if sqlDuplicate(err) {
+		return fmt.Errorf("company %v %w", name, ErrDuplicate)
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+	}
+	log.Printf("renamed company %v to %v", id, name)
+	return nil
+}
+
+// DeleteOne deletes the company and every record it owns, products first so
+// no reference is left dangling along the way
+func (c *SQLCompanyModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`DELETE FROM product_materials WHERE product_id IN (SELECT id FROM products WHERE company_id = $1)`,
+		`DELETE FROM product_lots WHERE product_id IN (SELECT id FROM products WHERE company_id = $1)`,
+		`DELETE FROM product_bom WHERE product_id IN (SELECT id FROM products WHERE company_id = $1)`,
+		`DELETE FROM products WHERE company_id = $1`,
+		`DELETE FROM materials WHERE company_id = $1`,
+		`DELETE FROM suppliers WHERE company_id = $1`,
+		`DELETE FROM certs WHERE company_id = $1`,
+		`DELETE FROM lots WHERE company_id = $1`,
+		`DELETE FROM api_keys WHERE company_id = $1`,
+		`DELETE FROM sessions WHERE company_id = $1`,
+		`DELETE FROM users WHERE company_id = $1`,
+		`DELETE FROM trash WHERE company_id = $1`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, id); err != nil {
+			return sqlError(err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM companies WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("company with ID %v %w", id, ErrNotFound)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("matched and deleted company %v", id)
+	return nil
+}
+
+type SQLAPIKeyModel struct {
+	DB *sql.DB
+}
+
+// SQLAPIKeyModel methods
+func (k *SQLAPIKeyModel) Add(ctx context.Context, key APIKey) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = k.DB.ExecContext(ctx, `INSERT INTO api_keys (id, company_id, name, prefix, role, hash, created_at, revoked)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		key.Id, companyID, key.Name, key.Prefix, key.Role, key.Hash, key.CreatedAt, key.Revoked)
+	if err != nil {
+		log.Println("Failed to insert API key: ", err)
+		return err
+	}
+	return nil
+}
+
+// query loads the API keys matching where
+func (k *SQLAPIKeyModel) query(ctx context.Context, where string, args ...interface{}) ([]APIKey, error) {
+	rows, err := k.DB.QueryContext(ctx, `SELECT id, company_id, name, prefix, role, hash, created_at, revoked FROM api_keys
+		WHERE `+where+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(&key.Id, &key.CompanyID, &key.Name, &key.Prefix, &key.Role, &key.Hash, &key.CreatedAt, &key.Revoked)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (k *SQLAPIKeyModel) GetAll(ctx context.Context) ([]APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return k.query(ctx, "company_id = $1", companyID)
+}
+
+func (k *SQLAPIKeyModel) FindByHash(ctx context.Context, hash string) (*APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	keys, err := k.query(ctx, "hash = $1", hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		return &keys[0], nil
+	}
+	return nil, fmt.Errorf("API key %w", ErrNotFound)
+}
+
+func (k *SQLAPIKeyModel) Revoke(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := k.DB.ExecContext(ctx, `UPDATE api_keys SET revoked = $1 WHERE id = $2 AND company_id = $3`, true, id, companyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("API key with ID %v %w", id, ErrNotFound)
+	}
+	log.Printf("revoked API key %v", id)
+	return nil
+}
+
+type SQLUserModel struct {
+	DB *sql.DB
+}
+
+// SQLUserModel methods
+func (u *SQLUserModel) Add(ctx context.Context, user User) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = u.DB.ExecContext(ctx, `INSERT INTO users (id, company_id, email, name, role, password_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		user.Id, companyID, user.Email, user.Name, user.Role, user.PasswordHash, user.CreatedAt)
+	if sqlDuplicate(err) {
+		return fmt.Errorf("user with email %v %w", user.Email, ErrDuplicate)
+	}
+	if err != nil {
+		log.Println("Failed to insert user: ", err)
+		return err
+	}
+	return nil
+}
+
+func (u *SQLUserModel) Update(ctx context.Context, user User) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := u.DB.ExecContext(ctx, `UPDATE users SET email = $1, name = $2, role = $3, password_hash = $4 WHERE id = $5 AND company_id = $6`,
+		user.Email, user.Name, user.Role, user.PasswordHash, user.Id, companyID)
+	if sqlDuplicate(err) {
+		return fmt.Errorf("user with email %v %w", user.Email, ErrDuplicate)
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+	log.Printf("matched and replaced user %v", user.Id)
+	return nil
+}
+
+// query loads the users matching where
+func (u *SQLUserModel) query(ctx context.Context, where string, args ...interface{}) ([]User, error) {
+	rows, err := u.DB.QueryContext(ctx, `SELECT id, company_id, email, name, role, password_hash, created_at FROM users
+		WHERE `+where+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.Id, &user.CompanyID, &user.Email, &user.Name, &user.Role, &user.PasswordHash, &user.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (u *SQLUserModel) GetAll(ctx context.Context) ([]User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return u.query(ctx, "company_id = $1", companyID)
+}
+
+func (u *SQLUserModel) GetOne(ctx context.Context, id string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := u.query(ctx, "company_id = $1 AND id = $2", companyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) > 0 {
+		return &users[0], nil
+	}
+	return nil, fmt.Errorf("user with ID %v %w", id, ErrNotFound)
+}
+
+func (u *SQLUserModel) FindByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	users, err := u.query(ctx, "email = $1", email)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) > 0 {
+		return &users[0], nil
+	}
+	return nil, fmt.Errorf("user with email %v %w", email, ErrNotFound)
+}
+
+// DeleteOne deletes the user and its sessions
+func (u *SQLUserModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1 AND company_id = $2`, id, companyID); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1 AND company_id = $2`, id, companyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("user with ID %v %w", id, ErrNotFound)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("matched and deleted user %v", id)
+	return nil
+}
+
+type SQLSessionModel struct {
+	DB *sql.DB
+}
+
+// SQLSessionModel methods
+func (s *SQLSessionModel) Add(ctx context.Context, session Session) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DB.ExecContext(ctx, `INSERT INTO sessions (id, company_id, user_id, created_at, expires_at, revoked)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		session.Id, companyID, session.UserID, session.CreatedAt, session.ExpiresAt, session.Revoked)
+	if err != nil {
+		log.Println("Failed to insert session: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *SQLSessionModel) GetOne(ctx context.Context, id string) (*Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var session Session
+	err := s.DB.QueryRowContext(ctx, `SELECT id, company_id, user_id, created_at, expires_at, revoked FROM sessions WHERE id = $1`, id).
+		Scan(&session.Id, &session.CompanyID, &session.UserID, &session.CreatedAt, &session.ExpiresAt, &session.Revoked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("session with ID %v %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *SQLSessionModel) Revoke(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, `UPDATE sessions SET revoked = $1 WHERE id = $2`, true, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("session with ID %v %w", id, ErrNotFound)
+	}
+	log.Printf("revoked session %v", id)
+	return nil
+}
+
+func (s *SQLSessionModel) RevokeByUser(ctx context.Context, userID string, except string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.DB.ExecContext(ctx, `UPDATE sessions SET revoked = $1 WHERE user_id = $2 AND company_id = $3 AND id <> $4`,
+		true, userID, companyID, except)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	log.Printf("revoked %d sessions of user %v", n, userID)
+	return nil
+}
+
+type SQLAuditModel struct {
+	DB *sql.DB
+}
+
+// SQLAuditModel methods, before, after and diff are stored as JSON text
+func (a *SQLAuditModel) Add(ctx context.Context, entry AuditEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+	diff, err := json.Marshal(entry.Diff)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.DB.ExecContext(ctx, `INSERT INTO audit (company_id, actor, at, entity_type, entity_id, operation, before_json, after_json, diff_json)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		companyID, entry.Actor, entry.Timestamp, entry.EntityType, entry.EntityID, entry.Operation,
+		string(entry.Before), string(entry.After), string(diff))
+	if err != nil {
+		log.Println("Failed to insert audit entry: ", err)
+		return err
+	}
+	return nil
+}
+
+func (a *SQLAuditModel) GetByEntity(ctx context.Context, entityID string) ([]AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := a.DB.QueryContext(ctx, `SELECT actor, at, entity_type, entity_id, operation, before_json, after_json, diff_json FROM audit
+		WHERE company_id = $1 AND entity_id = $2 ORDER BY seq`, companyID, entityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after, diff string
+		err := rows.Scan(&entry.Actor, &entry.Timestamp, &entry.EntityType, &entry.EntityID, &entry.Operation, &before, &after, &diff)
+		if err != nil {
+			return nil, err
+		}
+		if before != "" {
+			entry.Before = json.RawMessage(before)
+		}
+		if after != "" {
+			entry.After = json.RawMessage(after)
+		}
+		if err := json.Unmarshal([]byte(diff), &entry.Diff); err != nil {
+			return nil, err
+		}
+		entry.CompanyID = companyID
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+type SQLTrashModel struct {
+	DB *sql.DB
+}
+
+// SQLTrashModel methods, the record is stored as JSON text
+func (t *SQLTrashModel) Add(ctx context.Context, item TrashItem) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.DB.ExecContext(ctx, `INSERT INTO trash (company_id, entity_type, entity_id, deleted_at, deleted_by, record_json)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		companyID, item.EntityType, item.EntityID, item.DeletedAt, item.DeletedBy, string(item.Record))
+	if err != nil {
+		log.Println("Failed to insert trash item: ", err)
+		return err
+	}
+	return nil
+}
+
+// query loads the trash items matching where, which can use $1 as the company ID
+func (t *SQLTrashModel) query(ctx context.Context, companyID string, where string, args ...interface{}) ([]TrashItem, error) {
+	args = append([]interface{}{companyID}, args...)
+	rows, err := t.DB.QueryContext(ctx, `SELECT entity_type, entity_id, deleted_at, deleted_by, record_json FROM trash
+		WHERE company_id = $1 AND `+where+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []TrashItem{}
+	for rows.Next() {
+		var item TrashItem
+		var record string
+		if err := rows.Scan(&item.EntityType, &item.EntityID, &item.DeletedAt, &item.DeletedBy, &record); err != nil {
+			return nil, err
+		}
+		item.Record = json.RawMessage(record)
+		item.CompanyID = companyID
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (t *SQLTrashModel) GetAll(ctx context.Context) ([]TrashItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.query(ctx, companyID, "1 = 1")
+}
+
+func (t *SQLTrashModel) GetOne(ctx context.Context, entityID string) (*TrashItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := t.query(ctx, companyID, "entity_id = $2", entityID)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > 0 {
+		return &items[0], nil
+	}
+	return nil, fmt.Errorf("trash item with ID %v %w", entityID, ErrNotFound)
+}
+
+func (t *SQLTrashModel) DeleteOne(ctx context.Context, entityID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := currentCompany(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := t.DB.ExecContext(ctx, `DELETE FROM trash WHERE entity_id = $1 AND company_id = $2`, entityID, companyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("trash item with ID %v %w", entityID, ErrNotFound)
+	}
+	log.Printf("purged %v from the trash", entityID)
+	return nil
+}
+
+func (t *SQLTrashModel) PurgeBefore(ctx context.Context, before string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	res, err := t.DB.ExecContext(ctx, `DELETE FROM trash WHERE deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+var (
+	_ ProductRepository  = (*SQLProductModel)(nil)
+	_ MaterialRepository = (*SQLMaterialModel)(nil)
+	_ SupplierRepository = (*SQLSupplierModel)(nil)
+	_ CertRepository     = (*SQLCertModel)(nil)
+	_ LotRepository      = (*SQLLotModel)(nil)
+	_ CompanyRepository  = (*SQLCompanyModel)(nil)
+	_ APIKeyRepository   = (*SQLAPIKeyModel)(nil)
+	_ UserRepository     = (*SQLUserModel)(nil)
+	_ SessionRepository  = (*SQLSessionModel)(nil)
+	_ AuditRepository    = (*SQLAuditModel)(nil)
+	_ TrashRepository    = (*SQLTrashModel)(nil)
+)
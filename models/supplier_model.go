@@ -2,15 +2,12 @@ package models
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
-	"os"
 	"time"
 )
 
@@ -19,188 +16,148 @@ type Supplier struct {
 	Name    string `json:"name" bson:"name"`
 	Country string `json:"country" bson:"country"`
 	City    string `json:"city" bson:"city"`
+	Version int    `json:"version" bson:"version"`
+}
+
+// supplierDocument is how a supplier is stored in the suppliers collection
+type supplierDocument struct {
+	CompanyID primitive.ObjectID `bson:"company_id"`
+	Supplier  `bson:",inline"`
 }
 
 type SupplierModel struct {
 	COLLECTION *mongo.Collection
+	REFERENCES ReferenceMode
 }
 
 // SupplierModel methods
-func (s *SupplierModel) Add(supplier Supplier) error {
-	company := os.Getenv("COMPANY")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *SupplierModel) Add(ctx context.Context, supplier Supplier) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	var result bson.M
-	err := s.COLLECTION.FindOne(ctx, bson.D{{"name", companyFirstLMaiusc}}).Decode(&result)
-
+	companyID, err := mongoCompanyID(ctx)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil
-		}
 		return err
 	}
 
-	filter := bson.D{{"name", companyFirstLMaiusc}}
-	update := bson.D{{"$push", bson.D{{"suppliers", supplier}}}}
-
-	_, err = s.COLLECTION.UpdateOne(ctx, filter, update)
+	_, err = s.COLLECTION.InsertOne(ctx, supplierDocument{companyID, supplier})
 	if err != nil {
 		log.Println("Failed to insert supplier: ", err)
 		return err
 	}
 	return nil
-
 }
 
-func (s *SupplierModel) Update(supplier Supplier) error {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *SupplierModel) Update(ctx context.Context, supplier Supplier) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{"name": companyFirstLMaiusc, "suppliers.id": supplier.Id}
-	update := bson.D{{"$set", bson.D{{"suppliers.$", supplier}}}}
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
 
-	res, err := s.COLLECTION.UpdateOne(ctx, filter, update)
+	filter := bson.M{"company_id": companyID, "id": supplier.Id, "version": versionFilter(supplier.Version)}
+	supplier.Version++
+	res, err := s.COLLECTION.ReplaceOne(ctx, filter, supplierDocument{companyID, supplier})
 	if err != nil {
 		return err
 	}
-	if res.MatchedCount != 0 {
-		fmt.Printf("matched and replaced supplier %v", supplier.Id)
-		return nil
+	if res.MatchedCount == 0 {
+		return staleOrMissing(ctx, s.COLLECTION, companyID, "supplier", supplier.Id)
 	}
+	log.Printf("matched and replaced supplier %v", supplier.Id)
 
-	return errors.New("supplier not found")
+	// the supplier is saved, copies left stale by a failed propagation are
+	// replaced again on its next update
+	if s.REFERENCES == ReferenceEmbedded {
+		if err := s.propagate(ctx, companyID, supplier); err != nil {
+			log.Printf("supplier %v updated but its copies were not: %v", supplier.Id, err)
+		}
+	}
+	return nil
 }
 
-func (s *SupplierModel) GetAll() ([]Supplier, error) {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var result bson.M
+// propagate replaces the copies of supplier embedded in materials and in the
+// materials of products
+func (s *SupplierModel) propagate(ctx context.Context, companyID primitive.ObjectID, supplier Supplier) error {
+	database := s.COLLECTION.Database()
 
-	err := s.COLLECTION.FindOne(ctx, bson.D{{"name", companyFirstLMaiusc}}).Decode(&result)
-	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, nil
-		}
-		return nil, err
+	filter := bson.M{"company_id": companyID, "supplier.id": supplier.Id}
+	if _, err := database.Collection(materialsCollection).UpdateMany(ctx, filter, bson.M{"$set": bson.M{"supplier": supplier}}); err != nil {
+		return fmt.Errorf("materials: %v", err)
 	}
 
-	suppliersRaw, ok := result["suppliers"]
-	if !ok {
-		return nil, errors.New("field 'suppliers' not found")
+	filter = bson.M{"company_id": companyID, "materials.supplier.id": supplier.Id}
+	update := bson.M{"$set": bson.M{"materials.$[m].supplier": supplier}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"m.supplier.id": supplier.Id}},
+	})
+	if _, err := database.Collection(productsCollection).UpdateMany(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf("products: %v", err)
 	}
+	return nil
+}
 
-	suppliersJSON, err := json.Marshal(suppliersRaw)
+// find returns the suppliers of the current company matching filter
+func (s *SupplierModel) find(ctx context.Context, filter bson.M) ([]Supplier, error) {
+	companyID, err := mongoCompanyID(ctx)
 	if err != nil {
 		return nil, err
 	}
+	filter["company_id"] = companyID
 
-	var suppliers []Supplier
-	err = json.Unmarshal(suppliersJSON, &suppliers)
-	if err != nil {
+	var documents []supplierDocument
+	if err := findAll(ctx, s.COLLECTION, filter, &documents); err != nil {
 		return nil, err
 	}
 
+	suppliers := make([]Supplier, 0, len(documents))
+	for _, document := range documents {
+		suppliers = append(suppliers, document.Supplier)
+	}
 	return suppliers, nil
 }
 
-func (s *SupplierModel) GetOne(id string) (*Supplier, error) {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *SupplierModel) GetAll(ctx context.Context) ([]Supplier, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	pipeline := bson.A{
-		bson.D{
-			{"$match", bson.D{{"name", companyFirstLMaiusc}}},
-		},
-		bson.D{
-			{"$unwind", "$suppliers"},
-		},
-		bson.D{
-			{"$match", bson.D{{"suppliers.id", id}}},
-		},
-	}
+	return s.find(ctx, bson.M{})
+}
+
+func (s *SupplierModel) GetOne(ctx context.Context, id string) (*Supplier, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
 
-	cursor, err := s.COLLECTION.Aggregate(ctx, pipeline)
+	suppliers, err := s.find(ctx, bson.M{"id": id})
 	if err != nil {
 		return nil, err
 	}
-
-	var results []bson.M
-	if err := cursor.All(ctx, &results); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			fmt.Println("Object not found")
-			return nil, nil
-		} else {
-			log.Fatal(err)
-			return nil, err
-		}
-	}
-
-	if len(results) > 0 {
-		supplierBytes, err := json.Marshal(results[0]["suppliers"])
-		if err != nil {
-			return nil, err
-		}
-
-		var mySupplier Supplier
-		err = json.Unmarshal(supplierBytes, &mySupplier)
-		if err != nil {
-			return nil, err
-		}
-
-		return &mySupplier, nil
+	if len(suppliers) > 0 {
+		return &suppliers[0], nil
 	}
 
-	return nil, fmt.Errorf("supplier with ID %v not found", id)
+	return nil, fmt.Errorf("supplier with ID %v %w", id, ErrNotFound)
 }
 
-func (s *SupplierModel) DeleteOne(id string) error {
-	company := os.Getenv("COMPANY")
-	caser := cases.Title(language.English)
-	companyFirstLMaiusc := caser.String(company)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *SupplierModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	supplier, err := s.GetOne(id)
+	companyID, err := mongoCompanyID(ctx)
 	if err != nil {
 		return err
 	}
 
-	if supplier != nil {
-		filter := bson.D{{"name", companyFirstLMaiusc}}
-		update := bson.D{
-			{"$pull", bson.D{
-				{"suppliers", bson.D{{"id", id}}},
-			}},
-		}
-
-		res, err := s.COLLECTION.UpdateOne(ctx, filter, update)
-		if err != nil {
-			return err
-		}
-		if res.MatchedCount != 0 {
-			fmt.Printf("matched and deleted supplier %v", id)
-			return nil
-		}
+	res, err := s.COLLECTION.DeleteOne(ctx, bson.M{"company_id": companyID, "id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount != 0 {
+		log.Printf("matched and deleted supplier %v", id)
+		return nil
 	}
 
-	return errors.New("something went wrong")
+	return fmt.Errorf("supplier with ID %v %w", id, ErrNotFound)
 }
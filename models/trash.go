@@ -0,0 +1,173 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Deleted products, materials, suppliers, lots and certifications are moved
+// to the trash of their company, with who deleted them and when, instead of
+// being lost. They are gone from every other route until restored, and purged
+// for good by hand or once older than the retention period. A record goes to
+// the trash before it is deleted and leaves it again when the delete fails,
+// so it is never lost in between. Moving records out, rather than flagging
+// them deleted in place, keeps every query of every backend unaware of
+// deleted records.
+
+// TrashItem is a deleted record as it was when deleted
+type TrashItem struct {
+	EntityType string          `json:"entityType" bson:"entityType"`
+	EntityID   string          `json:"entityId" bson:"entityId"`
+	DeletedAt  string          `json:"deletedAt" bson:"deletedAt"`
+	DeletedBy  string          `json:"deletedBy" bson:"deletedBy"`
+	Record     json.RawMessage `json:"record" bson:"record"`
+	CompanyID  string          `json:"-" bson:"-"`
+}
+
+// TrashRepository stores the trash of the company in the context, PurgeBefore
+// empties the items deleted before a time (AuditTimeLayout) in every company
+type TrashRepository interface {
+	Add(ctx context.Context, item TrashItem) error
+	GetAll(ctx context.Context) ([]TrashItem, error)
+	GetOne(ctx context.Context, entityID string) (*TrashItem, error)
+	DeleteOne(ctx context.Context, entityID string) error
+	PurgeBefore(ctx context.Context, before string) (int64, error)
+}
+
+// trash copies record, about to be deleted, to the trash
+func trash(ctx context.Context, trash TrashRepository, entityType, entityID string, record interface{}) error {
+	item := TrashItem{
+		EntityType: entityType,
+		EntityID:   entityID,
+		DeletedAt:  time.Now().UTC().Format(AuditTimeLayout),
+		DeletedBy:  actor(ctx),
+	}
+	var err error
+	if item.Record, err = json.Marshal(record); err != nil {
+		return err
+	}
+	if err := trash.Add(ctx, item); err != nil {
+		return fmt.Errorf("%v %v not deleted, moving it to the trash failed: %v", entityType, entityID, err)
+	}
+	return nil
+}
+
+// untrash takes back the copy of a record whose delete failed
+func untrash(ctx context.Context, trash TrashRepository, entityType, entityID string) {
+	if err := trash.DeleteOne(ctx, entityID); err != nil {
+		log.Printf("%v %v was not deleted but stays in the trash: %v", entityType, entityID, err)
+	}
+}
+
+// withTrash wraps the repositories of repos whose deletes go to the trash
+func withTrash(repos *Repositories) *Repositories {
+	repos.Products = &trashedProducts{repos.Products, repos.Trash}
+	repos.Materials = &trashedMaterials{repos.Materials, repos.Trash}
+	repos.Suppliers = &trashedSuppliers{repos.Suppliers, repos.Trash}
+	repos.Lots = &trashedLots{repos.Lots, repos.Trash}
+	repos.Certs = &trashedCerts{repos.Certs, repos.Trash}
+	return repos
+}
+
+type trashedProducts struct {
+	ProductRepository
+	trash TrashRepository
+}
+
+func (t *trashedProducts) DeleteOne(ctx context.Context, id string) error {
+	product, err := t.ProductRepository.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := trash(ctx, t.trash, EntityProduct, id, product); err != nil {
+		return err
+	}
+	if err := t.ProductRepository.DeleteOne(ctx, id); err != nil {
+		untrash(ctx, t.trash, EntityProduct, id)
+		return err
+	}
+	return nil
+}
+
+type trashedMaterials struct {
+	MaterialRepository
+	trash TrashRepository
+}
+
+func (t *trashedMaterials) DeleteOne(ctx context.Context, id string) error {
+	material, err := t.MaterialRepository.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := trash(ctx, t.trash, EntityMaterial, id, material); err != nil {
+		return err
+	}
+	if err := t.MaterialRepository.DeleteOne(ctx, id); err != nil {
+		untrash(ctx, t.trash, EntityMaterial, id)
+		return err
+	}
+	return nil
+}
+
+type trashedSuppliers struct {
+	SupplierRepository
+	trash TrashRepository
+}
+
+func (t *trashedSuppliers) DeleteOne(ctx context.Context, id string) error {
+	supplier, err := t.SupplierRepository.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := trash(ctx, t.trash, EntitySupplier, id, supplier); err != nil {
+		return err
+	}
+	if err := t.SupplierRepository.DeleteOne(ctx, id); err != nil {
+		untrash(ctx, t.trash, EntitySupplier, id)
+		return err
+	}
+	return nil
+}
+
+type trashedLots struct {
+	LotRepository
+	trash TrashRepository
+}
+
+func (t *trashedLots) DeleteOne(ctx context.Context, id string) error {
+	lot, err := t.LotRepository.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := trash(ctx, t.trash, EntityLot, id, lot); err != nil {
+		return err
+	}
+	if err := t.LotRepository.DeleteOne(ctx, id); err != nil {
+		untrash(ctx, t.trash, EntityLot, id)
+		return err
+	}
+	return nil
+}
+
+type trashedCerts struct {
+	CertRepository
+	trash TrashRepository
+}
+
+func (t *trashedCerts) DeleteOne(ctx context.Context, id string) error {
+	cert, err := t.CertRepository.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := trash(ctx, t.trash, EntityCert, id, cert); err != nil {
+		return err
+	}
+	if err := t.CertRepository.DeleteOne(ctx, id); err != nil {
+		untrash(ctx, t.trash, EntityCert, id)
+		return err
+	}
+	return nil
+}
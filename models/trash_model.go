@@ -0,0 +1,111 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"time"
+)
+
+// trashDocument is how a deleted record is stored in the trash collection
+type trashDocument struct {
+	CompanyID primitive.ObjectID `bson:"company_id"`
+	TrashItem `bson:",inline"`
+}
+
+type TrashModel struct {
+	COLLECTION *mongo.Collection
+}
+
+// TrashModel methods
+func (t *TrashModel) Add(ctx context.Context, item TrashItem) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.COLLECTION.InsertOne(ctx, trashDocument{companyID, item})
+	if err != nil {
+		log.Println("Failed to insert trash item: ", err)
+		return err
+	}
+	return nil
+}
+
+// find returns the trash items of the current company matching filter
+func (t *TrashModel) find(ctx context.Context, filter bson.M) ([]TrashItem, error) {
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter["company_id"] = companyID
+
+	var documents []trashDocument
+	if err := findAll(ctx, t.COLLECTION, filter, &documents); err != nil {
+		return nil, err
+	}
+
+	items := make([]TrashItem, 0, len(documents))
+	for _, document := range documents {
+		items = append(items, document.TrashItem)
+	}
+	return items, nil
+}
+
+func (t *TrashModel) GetAll(ctx context.Context) ([]TrashItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return t.find(ctx, bson.M{})
+}
+
+func (t *TrashModel) GetOne(ctx context.Context, entityID string) (*TrashItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	items, err := t.find(ctx, bson.M{"entityId": entityID})
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > 0 {
+		return &items[0], nil
+	}
+	return nil, fmt.Errorf("trash item with ID %v %w", entityID, ErrNotFound)
+}
+
+func (t *TrashModel) DeleteOne(ctx context.Context, entityID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := t.COLLECTION.DeleteOne(ctx, bson.M{"company_id": companyID, "entityId": entityID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("trash item with ID %v %w", entityID, ErrNotFound)
+	}
+	log.Printf("purged %v from the trash", entityID)
+	return nil
+}
+
+func (t *TrashModel) PurgeBefore(ctx context.Context, before string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	res, err := t.COLLECTION.DeleteMany(ctx, bson.M{"deletedAt": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,24 @@
+package models
+
+// Unit is the unit of measure of a quantity of material
+type Unit string
+
+const (
+	UnitGram       Unit = "g"
+	UnitCarat      Unit = "ct"
+	UnitPiece      Unit = "pcs"
+	UnitCentimeter Unit = "cm"
+)
+
+// Units lists every known unit
+var Units = []Unit{UnitGram, UnitCarat, UnitPiece, UnitCentimeter}
+
+// Valid reports whether u is one of Units
+func (u Unit) Valid() bool {
+	for _, unit := range Units {
+		if u == unit {
+			return true
+		}
+	}
+	return false
+}
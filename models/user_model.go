@@ -0,0 +1,256 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"time"
+)
+
+// User is a person working for a company, logging in with Email and a
+// password of which only the bcrypt hash is stored. Emails are unique across
+// companies so logging in needs nothing else.
+type User struct {
+	Id           string `json:"id" bson:"id"`
+	Email        string `json:"email" bson:"email"`
+	Name         string `json:"name" bson:"name"`
+	Role         Role   `json:"role" bson:"role"`
+	PasswordHash string `json:"-" bson:"passwordHash"`
+	CreatedAt    string `json:"createdAt" bson:"createdAt"`
+	CompanyID    string `json:"-" bson:"-"`
+}
+
+// Session is a login of a user, the tokens handed out at login point to it so
+// they stop working once it is revoked or expired
+type Session struct {
+	Id        string `json:"id" bson:"id"`
+	UserID    string `json:"userId" bson:"userId"`
+	CreatedAt string `json:"createdAt" bson:"createdAt"`
+	ExpiresAt string `json:"expiresAt" bson:"expiresAt"`
+	Revoked   bool   `json:"revoked" bson:"revoked"`
+	CompanyID string `json:"-" bson:"-"`
+}
+
+// userDocument is how a user is stored in the users collection
+type userDocument struct {
+	CompanyID primitive.ObjectID `bson:"company_id"`
+	User      `bson:",inline"`
+}
+
+// sessionDocument is how a session is stored in the sessions collection
+type sessionDocument struct {
+	CompanyID primitive.ObjectID `bson:"company_id"`
+	Session   `bson:",inline"`
+}
+
+type UserModel struct {
+	COLLECTION *mongo.Collection
+}
+
+// UserModel methods
+func (u *UserModel) Add(ctx context.Context, user User) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = u.COLLECTION.InsertOne(ctx, userDocument{companyID, user})
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("user with email %v %w", user.Email, ErrDuplicate)
+	}
+	if err != nil {
+		log.Println("Failed to insert user: ", err)
+		return err
+	}
+	return nil
+}
+
+func (u *UserModel) Update(ctx context.Context, user User) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"company_id": companyID, "id": user.Id}
+	res, err := u.COLLECTION.ReplaceOne(ctx, filter, userDocument{companyID, user})
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("user with email %v %w", user.Email, ErrDuplicate)
+	}
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount != 0 {
+		log.Printf("matched and replaced user %v", user.Id)
+		return nil
+	}
+
+	return fmt.Errorf("user %w", ErrNotFound)
+}
+
+// find returns the users matching filter, with their CompanyID set
+func (u *UserModel) find(ctx context.Context, filter bson.M) ([]User, error) {
+	var documents []userDocument
+	if err := findAll(ctx, u.COLLECTION, filter, &documents); err != nil {
+		return nil, err
+	}
+
+	users := make([]User, 0, len(documents))
+	for _, document := range documents {
+		document.User.CompanyID = document.CompanyID.Hex()
+		users = append(users, document.User)
+	}
+	return users, nil
+}
+
+func (u *UserModel) GetAll(ctx context.Context) ([]User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return u.find(ctx, bson.M{"company_id": companyID})
+}
+
+func (u *UserModel) GetOne(ctx context.Context, id string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := u.find(ctx, bson.M{"company_id": companyID, "id": id})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) > 0 {
+		return &users[0], nil
+	}
+
+	return nil, fmt.Errorf("user with ID %v %w", id, ErrNotFound)
+}
+
+// FindByEmail looks a user up in every company
+func (u *UserModel) FindByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	users, err := u.find(ctx, bson.M{"email": email})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) > 0 {
+		return &users[0], nil
+	}
+
+	return nil, fmt.Errorf("user with email %v %w", email, ErrNotFound)
+}
+
+// DeleteOne deletes the user and its sessions
+func (u *UserModel) DeleteOne(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := u.COLLECTION.DeleteOne(ctx, bson.M{"company_id": companyID, "id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("user with ID %v %w", id, ErrNotFound)
+	}
+	log.Printf("matched and deleted user %v", id)
+
+	sessions := u.COLLECTION.Database().Collection(sessionsCollection)
+	_, err = sessions.DeleteMany(ctx, bson.M{"company_id": companyID, "userId": id})
+	return err
+}
+
+type SessionModel struct {
+	COLLECTION *mongo.Collection
+}
+
+// SessionModel methods
+func (s *SessionModel) Add(ctx context.Context, session Session) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.COLLECTION.InsertOne(ctx, sessionDocument{companyID, session})
+	if err != nil {
+		log.Println("Failed to insert session: ", err)
+		return err
+	}
+	return nil
+}
+
+// GetOne looks a session up in every company, its CompanyID is set
+func (s *SessionModel) GetOne(ctx context.Context, id string) (*Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var document sessionDocument
+	err := s.COLLECTION.FindOne(ctx, bson.M{"id": id}).Decode(&document)
+	if isNoDocuments(err) {
+		return nil, fmt.Errorf("session with ID %v %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	document.Session.CompanyID = document.CompanyID.Hex()
+	return &document.Session, nil
+}
+
+func (s *SessionModel) Revoke(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	res, err := s.COLLECTION.UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("session with ID %v %w", id, ErrNotFound)
+	}
+	log.Printf("revoked session %v", id)
+	return nil
+}
+
+// RevokeByUser revokes every session of the user but except, which can be ""
+func (s *SessionModel) RevokeByUser(ctx context.Context, userID string, except string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	companyID, err := mongoCompanyID(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"company_id": companyID, "userId": userID, "id": bson.M{"$ne": except}}
+	res, err := s.COLLECTION.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+	log.Printf("revoked %d sessions of user %v", res.ModifiedCount, userID)
+	return nil
+}
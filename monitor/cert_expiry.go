@@ -0,0 +1,129 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"marvinhagler/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LapsedSubject is a supplier or material whose certifications have all
+// expired, so it can no longer be sold as certified
+type LapsedSubject struct {
+	Type  string   `json:"type"`
+	Id    string   `json:"id"`
+	Name  string   `json:"name"`
+	Certs []string `json:"certs"`
+}
+
+// ExpiryReport lists the certifications expiring within a window, the ones
+// already expired and the subjects left without a valid certification
+type ExpiryReport struct {
+	Date     string          `json:"date"`
+	Until    string          `json:"until"`
+	Expiring []models.Cert   `json:"expiring"`
+	Expired  []models.Cert   `json:"expired"`
+	Lapsed   []LapsedSubject `json:"lapsed"`
+}
+
+// Empty tells whether there is nothing to report
+func (r *ExpiryReport) Empty() bool {
+	return len(r.Expiring) == 0 && len(r.Expired) == 0 && len(r.Lapsed) == 0
+}
+
+// ParseWithin reads a window like 30d, 2w or any time.ParseDuration value
+func ParseWithin(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, found := strings.CutSuffix(value, suffix); found {
+			n, err := strconv.Atoi(number)
+			if err != nil || n < 0 {
+				break
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	within, err := time.ParseDuration(value)
+	if err != nil || within < 0 {
+		return 0, fmt.Errorf("wrong window %q, use e.g. 30d, 2w or 72h", value)
+	}
+	return within, nil
+}
+
+// CertExpiry builds the report for the current company as of now. Dates are
+// compared by day: a certification expiring today is still valid.
+func CertExpiry(ctx context.Context, certs models.CertRepository, suppliers models.SupplierRepository, materials models.MaterialRepository,
+	now time.Time, within time.Duration) (*ExpiryReport, error) {
+	all, err := certs.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ExpiryReport{
+		Date:     now.Format(models.CertDateLayout),
+		Until:    now.Add(within).Format(models.CertDateLayout),
+		Expiring: []models.Cert{},
+		Expired:  []models.Cert{},
+		Lapsed:   []LapsedSubject{},
+	}
+
+	// subjects maps each supplier and material to its certifications, and
+	// valid to whether any of them is still valid
+	subjects := map[models.CertSubject][]string{}
+	valid := map[models.CertSubject]bool{}
+	for _, cert := range all {
+		expired := cert.ExpiryDate != "" && cert.ExpiryDate < report.Date
+		switch {
+		case expired:
+			report.Expired = append(report.Expired, cert)
+		case cert.ExpiryDate != "" && cert.ExpiryDate <= report.Until:
+			report.Expiring = append(report.Expiring, cert)
+		}
+
+		if cert.Subject.Type == models.SubjectSupplier || cert.Subject.Type == models.SubjectMaterial {
+			subjects[cert.Subject] = append(subjects[cert.Subject], cert.Id)
+			valid[cert.Subject] = valid[cert.Subject] || !expired
+		}
+	}
+
+	for subject, ids := range subjects {
+		if valid[subject] {
+			continue
+		}
+		name, err := subjectName(ctx, suppliers, materials, subject)
+		if err != nil {
+			return nil, err
+		}
+		report.Lapsed = append(report.Lapsed, LapsedSubject{Type: subject.Type, Id: subject.Id, Name: name, Certs: ids})
+	}
+	sort.Slice(report.Lapsed, func(i, j int) bool { return report.Lapsed[i].Id < report.Lapsed[j].Id })
+
+	return report, nil
+}
+
+// subjectName returns the name of a supplier or material, or "" if it no
+// longer exists
+func subjectName(ctx context.Context, suppliers models.SupplierRepository, materials models.MaterialRepository, subject models.CertSubject) (string, error) {
+	var name string
+	var err error
+	if subject.Type == models.SubjectSupplier {
+		var supplier *models.Supplier
+		if supplier, err = suppliers.GetOne(ctx, subject.Id); err == nil {
+			name = supplier.Name
+		}
+	} else {
+		var material *models.Material
+		if material, err = materials.GetOne(ctx, subject.Id); err == nil {
+			name = material.Name
+		}
+	}
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return "", err
+	}
+	return name, nil
+}
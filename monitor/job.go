@@ -0,0 +1,117 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"marvinhagler/models"
+	"marvinhagler/notify"
+	"strings"
+	"time"
+)
+
+// CertExpiryJob checks the certifications of every company every Interval and
+// notifies the ones expiring within Within, the expired ones and the lapsed
+// subjects. Each certification and subject is notified once per state while
+// it stays in the report, what was notified is only kept in memory: after a restart the current alerts of
+// every company are sent again.
+type CertExpiryJob struct {
+	Companies models.CompanyRepository
+	Certs     models.CertRepository
+	Suppliers models.SupplierRepository
+	Materials models.MaterialRepository
+	Notifier  notify.Notifier
+	Within    time.Duration
+	Interval  time.Duration
+
+	// notified is the last event sent, by company and cert or subject ID
+	notified map[string]string
+}
+
+// Run checks right away and then every Interval until ctx is done
+func (j *CertExpiryJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.Check(ctx, time.Now()); err != nil {
+			log.Println("Certification expiry check failed:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check builds the reports as of now and sends what was not notified yet. A
+// company whose report or notifications fail is logged and skipped, the
+// others are still checked.
+func (j *CertExpiryJob) Check(ctx context.Context, now time.Time) error {
+	companies, err := j.Companies.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	if j.notified == nil {
+		j.notified = map[string]string{}
+	}
+
+	for _, company := range companies {
+		if err := j.check(models.WithCompany(ctx, company.ID.Hex()), company, now); err != nil {
+			log.Printf("Certification expiry check of company %v failed: %v", company.Name, err)
+		}
+	}
+	return nil
+}
+
+// check notifies the report of company and forgets what left it, so a
+// certification renewed or a subject certified again is notified when it
+// lapses again. It goes on after a failed notification and returns the first
+// error.
+func (j *CertExpiryJob) check(ctx context.Context, company models.Company, now time.Time) error {
+	report, err := CertExpiry(ctx, j.Certs, j.Suppliers, j.Materials, now, j.Within)
+	if err != nil {
+		return err
+	}
+
+	companyID := company.ID.Hex()
+	reported := map[string]bool{}
+	var first error
+	send := func(id string, event string, message string, data interface{}) {
+		reported[companyID+"/"+id] = true
+		if err := j.notify(companyID, id, event, message, data); err != nil && first == nil {
+			first = err
+		}
+	}
+	for _, cert := range report.Expired {
+		send(cert.Id, "cert.expired", fmt.Sprintf("%v: certification %v (%v) expired on %v", company.Name, cert.Id, cert.Name, cert.ExpiryDate), cert)
+	}
+	for _, cert := range report.Expiring {
+		send(cert.Id, "cert.expiring", fmt.Sprintf("%v: certification %v (%v) expires on %v", company.Name, cert.Id, cert.Name, cert.ExpiryDate), cert)
+	}
+	for _, subject := range report.Lapsed {
+		send(subject.Id, "subject.lapsed", fmt.Sprintf("%v: %v %v (%v) has no valid certification left", company.Name, subject.Type, subject.Id, subject.Name), subject)
+	}
+
+	for key := range j.notified {
+		if strings.HasPrefix(key, companyID+"/") && !reported[key] {
+			delete(j.notified, key)
+		}
+	}
+	return first
+}
+
+// notify sends a notification unless one was already sent for id of the
+// company in the same state
+func (j *CertExpiryJob) notify(companyID string, id string, event string, message string, data interface{}) error {
+	key := companyID + "/" + id
+	if j.notified[key] == event {
+		return nil
+	}
+	if err := j.Notifier.Notify(notify.Notification{Event: event, Message: message, Data: data}); err != nil {
+		return err
+	}
+	j.notified[key] = event
+	return nil
+}
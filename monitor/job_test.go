@@ -0,0 +1,101 @@
+package monitor_test
+
+import (
+	"context"
+	"errors"
+	"marvinhagler/models"
+	"marvinhagler/monitor"
+	"marvinhagler/notify"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recorder keeps the notifications sent and fails the ones about broken
+type recorder struct {
+	broken string
+	sent   []notify.Notification
+}
+
+func (r *recorder) Notify(notification notify.Notification) error {
+	if r.broken != "" && strings.HasPrefix(notification.Message, r.broken+":") {
+		return errors.New("webhook down")
+	}
+	r.sent = append(r.sent, notification)
+	return nil
+}
+
+func newJob(t *testing.T, notifier notify.Notifier) (*monitor.CertExpiryJob, *models.Repositories) {
+	t.Helper()
+	repos := models.NewMemoryRepositories(models.ReferenceByID)
+	job := &monitor.CertExpiryJob{Companies: repos.Company, Certs: repos.Certs, Suppliers: repos.Suppliers, Materials: repos.Materials,
+		Notifier: notifier, Within: 30 * 24 * time.Hour}
+	return job, repos
+}
+
+// company creates a company holding one certification expiring on expiry
+func company(t *testing.T, repos *models.Repositories, name string, expiry string) context.Context {
+	t.Helper()
+	id := primitive.NewObjectID()
+	if err := repos.Company.Initialize(context.Background(), models.Company{ID: id, Name: name}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := models.WithCompany(context.Background(), id.Hex())
+	if err := repos.Certs.Add(ctx, models.Cert{Id: "CERT-" + name, Name: "RJC", ExpiryDate: expiry, Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+func day(t *testing.T, date string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(models.CertDateLayout, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestCheckNotifiesRenewedCertAgain(t *testing.T) {
+	notifier := &recorder{}
+	job, repos := newJob(t, notifier)
+	ctx := company(t, repos, "acme", "2026-01-10")
+
+	for _, date := range []string{"2026-01-01", "2026-01-02"} {
+		if err := job.Check(context.Background(), day(t, date)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(notifier.sent) != 1 {
+		t.Fatalf("got %d notifications, want the expiring one once: %+v", len(notifier.sent), notifier.sent)
+	}
+
+	renewed := models.Cert{Id: "CERT-acme", Name: "RJC", ExpiryDate: "2027-01-10", Version: 1}
+	if err := repos.Certs.Update(ctx, renewed); err != nil {
+		t.Fatal(err)
+	}
+	for _, date := range []string{"2026-01-03", "2027-01-01"} {
+		if err := job.Check(context.Background(), day(t, date)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(notifier.sent) != 2 || notifier.sent[1].Event != "cert.expiring" {
+		t.Errorf("got %+v, want the renewed certification notified when expiring again", notifier.sent)
+	}
+}
+
+func TestCheckGoesOnAfterFailedCompany(t *testing.T) {
+	notifier := &recorder{broken: "broken"}
+	job, repos := newJob(t, notifier)
+	company(t, repos, "broken", "2026-01-10")
+	company(t, repos, "acme", "2026-01-10")
+
+	if err := job.Check(context.Background(), day(t, "2026-01-01")); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.sent) != 1 || !strings.HasPrefix(notifier.sent[0].Message, "acme:") {
+		t.Errorf("got %+v, want acme notified", notifier.sent)
+	}
+}
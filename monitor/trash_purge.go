@@ -0,0 +1,46 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"marvinhagler/models"
+	"time"
+)
+
+// TrashPurgeJob empties every Interval the trash items of every company that
+// were deleted more than Retention ago
+type TrashPurgeJob struct {
+	Trash     models.TrashRepository
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+// Run purges right away and then every Interval until ctx is done
+func (j *TrashPurgeJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.Purge(ctx, time.Now()); err != nil {
+			log.Println("Trash purge failed:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge removes the items deleted before now minus Retention
+func (j *TrashPurgeJob) Purge(ctx context.Context, now time.Time) error {
+	before := now.Add(-j.Retention).UTC().Format(models.AuditTimeLayout)
+	purged, err := j.Trash.PurgeBefore(ctx, before)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Printf("purged %d trash items deleted before %v", purged, before)
+	}
+	return nil
+}
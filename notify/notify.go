@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Notification is something the people running WeeTracky should know about,
+// Data carries the records it is about
+type Notification struct {
+	Event   string      `json:"event"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Notifier delivers notifications, e.g. to the log or to a webhook
+type Notifier interface {
+	Notify(notification Notification) error
+}
+
+// LogNotifier writes notifications to the standard logger
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(notification Notification) error {
+	log.Printf("[%v] %v", notification.Event, notification.Message)
+	return nil
+}
+
+// WebhookNotifier posts notifications as JSON to URL
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) Notify(notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	res, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("failed to send notification: webhook answered %v", res.Status)
+	}
+	return nil
+}
+
+// FromEnv builds the notifier declared in NOTIFIER: log (default) or webhook,
+// which posts to NOTIFIER_WEBHOOK_URL
+func FromEnv() (Notifier, error) {
+	switch os.Getenv("NOTIFIER") {
+	case "", "log":
+		return LogNotifier{}, nil
+	case "webhook":
+		url := os.Getenv("NOTIFIER_WEBHOOK_URL")
+		if url == "" {
+			return nil, fmt.Errorf("NOTIFIER_WEBHOOK_URL is required by the webhook notifier")
+		}
+		return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	default:
+		return nil, fmt.Errorf("unknown NOTIFIER %q", os.Getenv("NOTIFIER"))
+	}
+}
@@ -2,40 +2,106 @@ package routes
 
 import (
 	"marvinhagler/handlers"
+	"marvinhagler/middleware"
+	"marvinhagler/models"
 	"net/http"
 )
 
+// Every route names the permission it requires, see models.Role for the
+// permissions of each role. The /auth routes only need to be logged in.
+
 func ProductsRouter(router *http.ServeMux, env *handlers.ProductsEnv) {
-	router.HandleFunc("/products/add", env.AddProductHandler)
-	router.HandleFunc("/products/update", env.UpdateProductHandler)
-	router.HandleFunc("/products/all", env.GetAllProductsHandler)
-	router.HandleFunc("/products/find-product", env.GetOneProductHandler)
-	router.HandleFunc("/products/find-by-material", env.GetProductsByMaterialHandler)
-	router.HandleFunc("/products/delete-product", env.DeleteOneProductHandler)
+	router.HandleFunc("/products/add", middleware.Require(models.PermProductsWrite, env.AddProductHandler))
+	router.HandleFunc("/products/update", middleware.Require(models.PermProductsWrite, env.UpdateProductHandler))
+	router.HandleFunc("/products/all", middleware.Require(models.PermProductsRead, env.GetAllProductsHandler))
+	router.HandleFunc("/products/find-product", middleware.Require(models.PermProductsRead, middleware.RequireForParam("at", models.PermAuditRead, env.GetOneProductHandler)))
+	router.HandleFunc("/products/find-by-material", middleware.Require(models.PermProductsRead, env.GetProductsByMaterialHandler))
+	router.HandleFunc("/products/provenance", middleware.Require(models.PermProductsRead, env.GetProvenanceHandler))
+	router.HandleFunc("/products/requirements", middleware.Require(models.PermProductsRead, env.GetRequirementsHandler))
+	router.HandleFunc("/products/cost", middleware.Require(models.PermProductsRead, env.GetCostHandler))
+	router.HandleFunc("/products/delete-product", middleware.Require(models.PermProductsDelete, env.DeleteOneProductHandler))
 }
 
 func MaterialsRouter(router *http.ServeMux, env *handlers.MaterialsEnv) {
-	router.HandleFunc("/materials/add", env.AddMaterialHandler)
-	router.HandleFunc("/materials/update", env.UpdateMaterialHandler)
-	router.HandleFunc("/materials/all", env.GetAllMaterialsHandler)
-	router.HandleFunc("/materials/find-material", env.GetOneMaterialHandler)
-	router.HandleFunc("/materials/find-by-supplier", env.GetMaterialsBySupplierHandler)
-	router.HandleFunc("/materials/delete-material", env.DeleteOneMaterialHandler)
+	router.HandleFunc("/materials/add", middleware.Require(models.PermMaterialsWrite, env.AddMaterialHandler))
+	router.HandleFunc("/materials/update", middleware.Require(models.PermMaterialsWrite, env.UpdateMaterialHandler))
+	router.HandleFunc("/materials/all", middleware.Require(models.PermMaterialsRead, env.GetAllMaterialsHandler))
+	router.HandleFunc("/materials/find-material", middleware.Require(models.PermMaterialsRead, middleware.RequireForParam("at", models.PermAuditRead, env.GetOneMaterialHandler)))
+	router.HandleFunc("/materials/find-by-supplier", middleware.Require(models.PermMaterialsRead, env.GetMaterialsBySupplierHandler))
+	router.HandleFunc("/materials/delete-material", middleware.Require(models.PermMaterialsDelete, env.DeleteOneMaterialHandler))
 }
 
 func SuppliersRouter(router *http.ServeMux, env *handlers.SuppliersEnv) {
-	router.HandleFunc("/suppliers/add", env.AddSupplierHandler)
-	router.HandleFunc("/suppliers/update", env.UpdateSupplierHandler)
-	router.HandleFunc("/suppliers/all", env.GetAllSuppliersHandler)
-	router.HandleFunc("/suppliers/find-supplier", env.GetOneSupplierHandler)
-	router.HandleFunc("/suppliers/delete-supplier", env.DeleteOneSupplierHandler)
+	router.HandleFunc("/suppliers/add", middleware.Require(models.PermSuppliersWrite, env.AddSupplierHandler))
+	router.HandleFunc("/suppliers/update", middleware.Require(models.PermSuppliersWrite, env.UpdateSupplierHandler))
+	router.HandleFunc("/suppliers/all", middleware.Require(models.PermSuppliersRead, env.GetAllSuppliersHandler))
+	router.HandleFunc("/suppliers/find-supplier", middleware.Require(models.PermSuppliersRead, middleware.RequireForParam("at", models.PermAuditRead, env.GetOneSupplierHandler)))
+	router.HandleFunc("/suppliers/delete-supplier", middleware.Require(models.PermSuppliersDelete, env.DeleteOneSupplierHandler))
 }
 
 func CertsRouter(router *http.ServeMux, env *handlers.CertsEnv) {
-	router.HandleFunc("/certs/add", env.AddCertHandler)
-	router.HandleFunc("certs/all", env.GetAllCertsHandler)
+	router.HandleFunc("/certs/add", middleware.Require(models.PermCertsWrite, env.AddCertHandler))
+	router.HandleFunc("/certs/update", middleware.Require(models.PermCertsWrite, env.UpdateCertHandler))
+	router.HandleFunc("/certs/all", middleware.Require(models.PermCertsRead, env.GetAllCertsHandler))
+	router.HandleFunc("/certs/find-cert", middleware.Require(models.PermCertsRead, middleware.RequireForParam("at", models.PermAuditRead, env.GetOneCertHandler)))
+	router.HandleFunc("/certs/find-by-subject", middleware.Require(models.PermCertsRead, env.GetCertsBySubjectHandler))
+	router.HandleFunc("/certs/expiring", middleware.Require(models.PermCertsRead, env.GetExpiringCertsHandler))
+	router.HandleFunc("/certs/delete-cert", middleware.Require(models.PermCertsDelete, env.DeleteOneCertHandler))
+}
+
+func LotsRouter(router *http.ServeMux, env *handlers.LotsEnv) {
+	router.HandleFunc("/lots/add", middleware.Require(models.PermLotsWrite, env.AddLotHandler))
+	router.HandleFunc("/lots/update", middleware.Require(models.PermLotsWrite, env.UpdateLotHandler))
+	router.HandleFunc("/lots/all", middleware.Require(models.PermLotsRead, env.GetAllLotsHandler))
+	router.HandleFunc("/lots/find-lot", middleware.Require(models.PermLotsRead, middleware.RequireForParam("at", models.PermAuditRead, env.GetOneLotHandler)))
+	router.HandleFunc("/lots/find-by-material", middleware.Require(models.PermLotsRead, env.GetLotsByMaterialHandler))
+	router.HandleFunc("/lots/delete-lot", middleware.Require(models.PermLotsDelete, env.DeleteOneLotHandler))
+}
+
+func TraceRouter(router *http.ServeMux, env *handlers.TraceEnv) {
+	router.HandleFunc("/trace/forward", middleware.Require(models.PermLotsRead, env.TraceForwardHandler))
+	router.HandleFunc("/trace/backward", middleware.Require(models.PermLotsRead, env.TraceBackwardHandler))
+	router.HandleFunc("/trace/impact", middleware.Require(models.PermLotsRead, env.TraceImpactHandler))
 }
 
 func CompanyRouter(router *http.ServeMux, env *handlers.CompanyEnv) {
-	router.HandleFunc("/company/init", env.InitializeCompanyHandler)
+	router.HandleFunc("/company/init", middleware.Require(models.PermCompanyManage, env.InitializeCompanyHandler))
+	router.HandleFunc("/company/all", middleware.Require(models.PermCompanyManage, env.GetAllCompaniesHandler))
+	router.HandleFunc("/company/find-company", middleware.Require(models.PermCompanyManage, env.GetOneCompanyHandler))
+	router.HandleFunc("/company/rename", middleware.Require(models.PermCompanyManage, env.RenameCompanyHandler))
+	router.HandleFunc("/company/delete-company", middleware.Require(models.PermCompanyManage, env.DeleteOneCompanyHandler))
+}
+
+func KeysRouter(router *http.ServeMux, env *handlers.KeysEnv) {
+	router.HandleFunc("/keys/create", middleware.Require(models.PermKeysManage, env.CreateKeyHandler))
+	router.HandleFunc("/keys/all", middleware.Require(models.PermKeysManage, env.GetAllKeysHandler))
+	router.HandleFunc("/keys/revoke", middleware.Require(models.PermKeysManage, env.RevokeKeyHandler))
+}
+
+func UsersRouter(router *http.ServeMux, env *handlers.UsersEnv) {
+	router.HandleFunc("/users/add", middleware.Require(models.PermUsersManage, env.AddUserHandler))
+	router.HandleFunc("/users/update", middleware.Require(models.PermUsersManage, env.UpdateUserHandler))
+	router.HandleFunc("/users/all", middleware.Require(models.PermUsersManage, env.GetAllUsersHandler))
+	router.HandleFunc("/users/find-user", middleware.Require(models.PermUsersManage, env.GetOneUserHandler))
+	router.HandleFunc("/users/delete-user", middleware.Require(models.PermUsersManage, env.DeleteOneUserHandler))
+	router.HandleFunc("/users/revoke-sessions", middleware.Require(models.PermUsersManage, env.RevokeUserSessionsHandler))
+}
+
+func AuthRouter(router *http.ServeMux, env *handlers.AuthEnv) {
+	router.HandleFunc("/auth/login", env.LoginHandler)
+	router.HandleFunc("/auth/logout", env.LogoutHandler)
+	router.HandleFunc("/auth/password", env.ChangePasswordHandler)
+	router.HandleFunc("/auth/me", env.MeHandler)
+}
+
+func TrashRouter(router *http.ServeMux, env *handlers.TrashEnv) {
+	router.HandleFunc("/trash", middleware.Require(models.PermTrashRead, env.GetTrashHandler))
+	router.HandleFunc("/trash/all", middleware.Require(models.PermTrashRead, env.GetTrashHandler))
+	router.HandleFunc("/trash/restore", middleware.Require(models.PermTrashManage, env.RestoreHandler))
+	router.HandleFunc("/trash/purge", middleware.Require(models.PermTrashManage, env.PurgeHandler))
+}
+
+func AuditRouter(router *http.ServeMux, env *handlers.AuditEnv) {
+	router.HandleFunc("/audit", middleware.Require(models.PermAuditRead, env.GetAuditHandler))
+	router.HandleFunc("/history", middleware.Require(models.PermAuditRead, env.GetHistoryHandler))
 }